@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	accessCRD         = flag.Bool("access-crd", false, "merge the spec of VaultAccess resources into the policies and roles of matching service accounts")
+	accessCRDResource = flag.String("access-crd-resource", "vault.io/v1alpha1/vaultaccesses", "group/version/resource of the VaultAccess custom resources")
+	accessCRDSubtree  = flag.String("access-crd-subtree-template", "{{.Context}}/{{.Namespace}}", "template of the KV subtree the paths of a namespace's VaultAccess resources must stay within")
+	accessCRDPolicies = flag.String("access-crd-policies", "", "comma-separated policies VaultAccess resources may attach to roles, none when empty")
+)
+
+// kvEndpoints KV version 2 endpoints VaultAccess paths may use
+var kvEndpoints = []string{"data", "metadata", "delete", "undelete", "destroy"}
+
+// accessPath extra path block declared by a VaultAccess resource
+type accessPath struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// accessSpec spec of a VaultAccess resource, declaring the access of the
+// service account it names in addition to the generated defaults
+type accessSpec struct {
+	ServiceAccountName string       `json:"serviceAccountName"`
+	Paths              []accessPath `json:"paths"`
+	// TTL of tokens issued by the role instead of the default
+	TTL string `json:"ttl"`
+	// Policies attached to the role in addition to the generated ones
+	Policies []string `json:"policies"`
+}
+
+// accessCache lists VaultAccess resources, caching them per namespace
+type accessCache struct {
+	clientset kubernetes.Interface
+	// context the resources' subtrees are rendered with
+	context string
+	specs   map[string]map[string]*accessSpec
+}
+
+// newAccessCache returns an accessCache using clientset in context
+func newAccessCache(clientset kubernetes.Interface, context string) *accessCache {
+	return &accessCache{
+		clientset: clientset,
+		context:   context,
+		specs:     map[string]map[string]*accessSpec{},
+	}
+}
+
+// get returns the access spec of the service account, nil when no resource
+// names it
+func (cache *accessCache) get(namespace, account string) (*accessSpec, error) {
+	specs, ok := cache.specs[namespace]
+	if !ok {
+		var err error
+		specs, err = cache.list(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s in %s: %v", *accessCRDResource, namespace, err)
+		}
+		cache.specs[namespace] = specs
+	}
+	return specs[account], nil
+}
+
+// list returns the validated specs of the namespace's VaultAccess
+// resources by service account, none when the CRD is not installed
+func (cache *accessCache) list(namespace string) (map[string]*accessSpec, error) {
+	parts := strings.Split(*accessCRDResource, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("resource %q should be group/version/resource", *accessCRDResource)
+	}
+
+	raw, err := cache.clientset.Discovery().RESTClient().Get().
+		AbsPath("/apis", parts[0], parts[1], "namespaces", namespace, parts[2]).
+		DoRaw()
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec accessSpec `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+
+	prefixes, err := accessPathPrefixes(cache.context, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := map[string]*accessSpec{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if err := item.Spec.validate(prefixes); err != nil {
+			return nil, fmt.Errorf("%s: %v", item.Metadata.Name, err)
+		}
+		if _, ok := specs[item.Spec.ServiceAccountName]; ok {
+			return nil, fmt.Errorf("%s: more than one resource for service account %s", item.Metadata.Name, item.Spec.ServiceAccountName)
+		}
+		specs[item.Spec.ServiceAccountName] = &item.Spec
+	}
+
+	return specs, nil
+}
+
+// accessPathPrefixes returns the KV paths the VaultAccess resources of the
+// namespace may grant, the namespace's subtree below every KV endpoint
+func accessPathPrefixes(context, namespace string) ([]string, error) {
+	scope := namespaceService(context, namespace)
+	subtree := strings.Trim(scope.parseTemplate(*accessCRDSubtree), "/")
+	if subtree == "" || strings.Contains(subtree, "*") || strings.Contains(subtree, "+") {
+		return nil, fmt.Errorf("invalid VaultAccess subtree %q of namespace %s", subtree, namespace)
+	}
+
+	if *kvVersion == 1 {
+		return []string{kvPath("", subtree)}, nil
+	}
+	var prefixes []string
+	for _, endpoint := range kvEndpoints {
+		prefixes = append(prefixes, kvPath(endpoint, subtree))
+	}
+	return prefixes, nil
+}
+
+// withinPrefixes reports whether path is one of prefixes or below one
+func withinPrefixes(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the spec before it is merged into a policy or role: its
+// paths must stay within prefixes and its policies must be allowed by
+// -access-crd-policies
+func (spec *accessSpec) validate(prefixes []string) error {
+	if spec.ServiceAccountName == "" {
+		return errors.New("serviceAccountName is required")
+	}
+	for _, path := range spec.Paths {
+		if strings.TrimLeft(path.Path, "/") == "" || len(path.Capabilities) == 0 {
+			return fmt.Errorf("path %q needs a path and capabilities", path.Path)
+		}
+		if !withinPrefixes(strings.TrimLeft(path.Path, "/"), prefixes) {
+			return fmt.Errorf("path %q is outside the namespace's subtree %s", path.Path, strings.Join(prefixes, ", "))
+		}
+		for _, capability := range path.Capabilities {
+			if !vaultCapabilities[capability] {
+				return fmt.Errorf("path %q: unknown capability %q", path.Path, capability)
+			}
+		}
+	}
+	if spec.TTL != "" {
+		if _, err := time.ParseDuration(spec.TTL); err != nil {
+			return fmt.Errorf("ttl: %v", err)
+		}
+	}
+	allowed, err := splitList(*accessCRDPolicies)
+	if err != nil {
+		return err
+	}
+	for _, policy := range spec.Policies {
+		if policy == "root" || !contains(allowed, policy) {
+			return fmt.Errorf("policy %q is not allowed by -access-crd-policies", policy)
+		}
+	}
+	return nil
+}
+
+// accessStanzas returns the path blocks declared by the service's
+// VaultAccess resource
+func (service *Service) accessStanzas() []policyStanza {
+	if service.Access == nil {
+		return nil
+	}
+
+	var stanzas []policyStanza
+	for _, path := range service.Access.Paths {
+		stanzas = append(stanzas, policyStanza{Path: strings.TrimLeft(path.Path, "/"), Capabilities: path.Capabilities})
+	}
+	return stanzas
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccessSpecValidate(t *testing.T) {
+	defer setFlag(t, "access-crd-policies", "payments-reader")()
+
+	prefixes, err := accessPathPrefixes("prod", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		spec accessSpec
+		err  string
+	}{
+		{"own subtree", accessSpec{ServiceAccountName: "api", Paths: []accessPath{{Path: "secret/data/prod/shop/common/*", Capabilities: []string{"read"}}}}, ""},
+		{"own metadata", accessSpec{ServiceAccountName: "api", Paths: []accessPath{{Path: "secret/metadata/prod/shop", Capabilities: []string{"list"}}}}, ""},
+		{"allowed policy", accessSpec{ServiceAccountName: "api", Policies: []string{"payments-reader"}}, ""},
+		{"other namespace", accessSpec{ServiceAccountName: "api", Paths: []accessPath{{Path: "secret/data/prod/billing/*", Capabilities: []string{"read"}}}}, "outside"},
+		{"namespace prefix", accessSpec{ServiceAccountName: "api", Paths: []accessPath{{Path: "secret/data/prod/shop*", Capabilities: []string{"read"}}}}, "outside"},
+		{"sys", accessSpec{ServiceAccountName: "api", Paths: []accessPath{{Path: "sys/*", Capabilities: []string{"sudo"}}}}, "outside"},
+		{"unlisted policy", accessSpec{ServiceAccountName: "api", Policies: []string{"admin"}}, "not allowed"},
+		{"root policy", accessSpec{ServiceAccountName: "api", Policies: []string{"root"}}, "not allowed"},
+		{"no service account", accessSpec{}, "serviceAccountName"},
+	}
+
+	for _, test := range tests {
+		err := test.spec.validate(prefixes)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestAccessSpecValidateNoPolicies(t *testing.T) {
+	prefixes, err := accessPathPrefixes("prod", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := accessSpec{ServiceAccountName: "api", Policies: []string{"payments-reader"}}
+	if err := spec.validate(prefixes); err == nil {
+		t.Error("attached a policy without -access-crd-policies")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var policyPerSA = flag.Bool("policy-per-sa", false, "write one policy and role per service account and namespace, granting the secret subtrees of all its deployments")
+
+// groupByAccount merges the services of each service account in a namespace
+// into a single service named after the account, whose policy grants the
+// secret subtree of every member deployment. Failed accounts are returned
+// by namespace/account.
+func groupByAccount(services []Service) ([]Service, map[string]error) {
+	var grouped []Service
+	errs := map[string]error{}
+	members := map[string][]Service{}
+	var accounts []string
+
+	for _, service := range services {
+		key := service.Namespace + "/" + service.AccountName
+		if _, ok := members[key]; !ok {
+			accounts = append(accounts, key)
+		}
+		members[key] = append(members[key], service)
+	}
+
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		service, err := mergeAccount(members[account])
+		if err != nil {
+			errs[account] = err
+			continue
+		}
+		grouped = append(grouped, service)
+	}
+
+	return grouped, errs
+}
+
+// mergeAccount returns the single service of the service account shared by
+// members
+func mergeAccount(members []Service) (Service, error) {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	first := members[0]
+	namespaces := map[string]bool{}
+	var names []string
+
+	for _, member := range members {
+		if !mergeable(first, member) {
+			return Service{}, fmt.Errorf("service account %s/%s: deployments %s and %s differ in tier, phase, audiences or VaultAccess", first.Namespace, first.AccountName, first.Name, member.Name)
+		}
+		for _, namespace := range member.Namespaces {
+			namespaces[namespace] = true
+		}
+		names = append(names, member.Name)
+	}
+
+	merged := first
+	merged.Name = first.AccountName
+	merged.Namespaces = sortedKeys(namespaces)
+	merged.Deployments = names
+	return merged, nil
+}
+
+// subtreeNames returns the names the service's secret subtrees are named
+// after: its deployments when grouped per service account, else its own
+func (service *Service) subtreeNames() []string {
+	if len(service.Deployments) > 0 {
+		return service.Deployments
+	}
+	return []string{service.Name}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// backendServices returns api, worker and cron running as backend in shop,
+// and web running as its own account
+func backendServices() []Service {
+	var services []Service
+	for _, name := range []string{"worker", "api", "cron"} {
+		service := testService("shop", name)
+		service.AccountName = "backend"
+		services = append(services, service)
+	}
+	return append(services, testService("shop", "web"))
+}
+
+func TestGroupByAccount(t *testing.T) {
+	grouped, errs := groupByAccount(backendServices())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(grouped) != 2 {
+		t.Fatalf("grouped = %+v, want backend and web", grouped)
+	}
+
+	backend := grouped[0]
+	if backend.Name != "backend" || backend.policyName() != "prod-shop-backend" {
+		t.Errorf("service %s with policy %s, want backend with prod-shop-backend", backend.Name, backend.policyName())
+	}
+	if want := []string{"api", "cron", "worker"}; !reflect.DeepEqual(backend.Deployments, want) {
+		t.Errorf("deployments = %v, want %v", backend.Deployments, want)
+	}
+
+	stanzas, err := backend.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []policyStanza{
+		{Path: "secret/data/prod/shop/api/*", Capabilities: []string{"read", "list"}},
+		{Path: "secret/data/prod/shop/cron/*", Capabilities: []string{"read", "list"}},
+		{Path: "secret/data/prod/shop/worker/*", Capabilities: []string{"read", "list"}},
+	}
+	if !reflect.DeepEqual(stanzas, want) {
+		t.Errorf("stanzas = %+v, want %+v", stanzas, want)
+	}
+
+	if web := grouped[1]; web.Name != "web" || !reflect.DeepEqual(web.subtreeNames(), []string{"web"}) {
+		t.Errorf("web grouped as %s with subtrees %v", web.Name, web.subtreeNames())
+	}
+}
+
+func TestMergeAccountBoundNamespaces(t *testing.T) {
+	services := backendServices()[:2]
+	services[1].Namespaces = []string{"ops", "shop"}
+
+	merged, err := mergeAccount(services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ops", "shop"}; !reflect.DeepEqual(merged.Namespaces, want) {
+		t.Errorf("namespaces = %v, want %v", merged.Namespaces, want)
+	}
+}
+
+func TestMergeAccountMismatch(t *testing.T) {
+	services := backendServices()[:2]
+	services[0].Phase = phaseBootstrap
+
+	if _, err := mergeAccount(services); err == nil {
+		t.Error("deployments differing in phase were merged")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var checkAutomount = flag.Bool("check-automount", false, "warn (fail with -strict) about workloads which cannot present a service account token to Vault")
+
+// serviceAccountCache looks up service accounts, caching them for the run
+type serviceAccountCache struct {
+	clientset kubernetes.Interface
+	accounts  map[string]*corev1.ServiceAccount
+}
+
+// newServiceAccountCache returns a serviceAccountCache using clientset
+func newServiceAccountCache(clientset kubernetes.Interface) *serviceAccountCache {
+	return &serviceAccountCache{
+		clientset: clientset,
+		accounts:  map[string]*corev1.ServiceAccount{},
+	}
+}
+
+// get returns the service account, nil when it does not exist
+func (cache *serviceAccountCache) get(namespace, name string) (*corev1.ServiceAccount, error) {
+	key := namespace + "/" + name
+	if account, ok := cache.accounts[key]; ok {
+		return account, nil
+	}
+
+	account, err := cache.clientset.CoreV1().ServiceAccounts(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		account, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading service account %s: %v", key, err)
+	}
+
+	cache.accounts[key] = account
+	return account, nil
+}
+
+// automountDisabled reports whether pods of deployment get no service
+// account token to log in to Vault with: automounting is disabled on the pod
+// or, unless the pod enables it, on the service account, and no token is
+// projected into a volume explicitly
+func automountDisabled(deployment appsv1.Deployment, account *corev1.ServiceAccount) bool {
+	spec := deployment.Spec.Template.Spec
+
+	for _, volume := range spec.Volumes {
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ServiceAccountToken != nil {
+				return false
+			}
+		}
+	}
+
+	// the pod's setting takes precedence over the service account's
+	if spec.AutomountServiceAccountToken != nil {
+		return !*spec.AutomountServiceAccountToken
+	}
+
+	return account != nil && account.AutomountServiceAccountToken != nil && !*account.AutomountServiceAccountToken
+}
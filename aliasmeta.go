@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var aliasMetadataLabels = flag.String("alias-metadata-labels", "", "comma-separated key=label pairs of deployment labels recorded as identity metadata in markers, e.g. team=team,app=app.kubernetes.io/name")
+
+// aliasMetadataMapping parsed -alias-metadata-labels, metadata key to label key
+var aliasMetadataMapping map[string]string
+
+// parseLabelMapping parses comma-separated key=label pairs
+func parseLabelMapping(value string) (map[string]string, error) {
+	items, err := splitList(value)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	mapping := map[string]string{}
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("%q should be key=label", item)
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("key %q is mapped twice", key)
+		}
+		mapping[key] = strings.TrimSpace(parts[1])
+	}
+	return mapping, nil
+}
+
+// aliasMetadata returns the metadata of the service's identity taken from
+// its labels, labels it does not have are left out
+func (service *Service) aliasMetadata() map[string]string {
+	if len(aliasMetadataMapping) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(aliasMetadataMapping))
+	for key := range aliasMetadataMapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metadata := map[string]string{}
+	for _, key := range keys {
+		if value, ok := service.Labels[sanitizeLabelKey(aliasMetadataMapping[key])]; ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
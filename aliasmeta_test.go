@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelMapping(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+		err   bool
+	}{
+		{"", nil, false},
+		{"team=team", map[string]string{"team": "team"}, false},
+		{" team = team , app=app.kubernetes.io/name", map[string]string{"team": "team", "app": "app.kubernetes.io/name"}, false},
+		{"selector=a=b", map[string]string{"selector": "a=b"}, false},
+		{"team", nil, true},
+		{"team=", nil, true},
+		{"=team", nil, true},
+		{"team=team,", nil, true},
+		{"team=team,team=owner", nil, true},
+	}
+
+	for _, test := range tests {
+		mapping, err := parseLabelMapping(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseLabelMapping(%q) error = %v, want error %v", test.value, err, test.err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(mapping, test.want) {
+			t.Errorf("parseLabelMapping(%q) = %v, want %v", test.value, mapping, test.want)
+		}
+	}
+}
+
+func TestAliasMetadata(t *testing.T) {
+	previous := aliasMetadataMapping
+	defer func() {
+		aliasMetadataMapping = previous
+	}()
+
+	service := testService("shop", "api")
+	service.Labels = map[string]string{"team": "payments", "app_kubernetes_io_name": "checkout"}
+
+	aliasMetadataMapping = nil
+	if metadata := service.aliasMetadata(); metadata != nil {
+		t.Errorf("metadata = %v without -alias-metadata-labels, want none", metadata)
+	}
+
+	aliasMetadataMapping = map[string]string{"team": "team", "app": "app.kubernetes.io/name", "owner": "owner"}
+	want := map[string]string{"team": "payments", "app": "checkout"}
+	if metadata := service.aliasMetadata(); !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %v, want %v", metadata, want)
+	}
+
+	data := newMarker(service, "prod-shop-api", "auth/kubernetes/role/prod-shop-api-role").data()
+	if !reflect.DeepEqual(data["alias_metadata"], want) {
+		t.Errorf("marker alias_metadata = %v, want %v", data["alias_metadata"], want)
+	}
+}
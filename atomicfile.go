@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes content to path with permissions perm through a
+// temporary file renamed over it, readers never see a partial file
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
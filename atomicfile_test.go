@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "inventory.prom")
+	for _, content := range []string{"first\n", "second\n"} {
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+
+	// the temporary file is renamed or removed
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files left in %s, want only %s", len(files), dir, path)
+	}
+}
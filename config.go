@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// envFlags maps flag names to environment variables overriding their defaults
+var envFlags = map[string]string{
+	"vault-addr":      "VAULT_ADDR",
+	"vault-namespace": "VAULT_NAMESPACE",
+}
+
+// envValues values of envFlags environment variables seen by applyEnvDefaults,
+// by flag name
+var envValues = map[string]string{}
+
+// settingLayer a single source which provided a value for a setting
+type settingLayer struct {
+	Source string
+	Value  string
+}
+
+// applyEnvDefaults sets flags which were not given on the command line from
+// their environment variables, must be called after flag.Parse. Values are
+// set on the flag directly so that flag.Visit still only reports command line
+// flags
+func applyEnvDefaults() error {
+	explicit := explicitFlags()
+
+	for name, env := range envFlags {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		envValues[name] = value
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Lookup(name).Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, env, err)
+		}
+	}
+
+	return nil
+}
+
+// explicitFlags returns names of flags set on the command line
+func explicitFlags() map[string]bool {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// settingLayers returns every value a flag received, lowest precedence first:
+// built-in default, environment variable, -template-git-url, command line flag
+func settingLayers(f *flag.Flag, explicit map[string]bool) []settingLayer {
+	layers := []settingLayer{{Source: "default", Value: f.DefValue}}
+
+	if value, ok := envValues[f.Name]; ok {
+		layers = append(layers, settingLayer{Source: "env " + envFlags[f.Name], Value: value})
+	}
+
+	if value, ok := gitTemplateValues[f.Name]; ok {
+		layers = append(layers, settingLayer{Source: "git " + *templateGitURL, Value: value})
+	}
+
+	if explicit[f.Name] {
+		layers = append(layers, settingLayer{Source: "flag -" + f.Name, Value: f.Value.String()})
+	}
+
+	return layers
+}
+
+// printConfigTrace writes, for every setting, the final value, where it came from
+// and which lower precedence values it overrode
+func printConfigTrace(w io.Writer) {
+	explicit := explicitFlags()
+
+	flag.VisitAll(func(f *flag.Flag) {
+		layers := settingLayers(f, explicit)
+		final := layers[len(layers)-1]
+
+		fmt.Fprintf(w, "%s = %q (from %s)\n", f.Name, f.Value.String(), final.Source)
+		for i := len(layers) - 2; i >= 0; i-- {
+			fmt.Fprintf(w, "    overrides %s: %q\n", layers[i].Source, layers[i].Value)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestApplyEnvDefaults(t *testing.T) {
+	defer setFlag(t, "vault-addr", *vaultAddr)()
+	defer func() {
+		delete(envValues, "vault-addr")
+	}()
+
+	os.Setenv("VAULT_ADDR", "https://vault.example.com:8200")
+	defer os.Unsetenv("VAULT_ADDR")
+
+	if err := applyEnvDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if *vaultAddr != "https://vault.example.com:8200" {
+		t.Errorf("-vault-addr = %q, want the VAULT_ADDR value", *vaultAddr)
+	}
+	if explicitFlags()["vault-addr"] {
+		t.Error("-vault-addr from VAULT_ADDR reported as a command line flag")
+	}
+
+	f := flag.Lookup("vault-addr")
+	layers := settingLayers(f, explicitFlags())
+	if final := layers[len(layers)-1]; final.Source != "env VAULT_ADDR" || final.Value != "https://vault.example.com:8200" {
+		t.Errorf("final layer = %+v, want env VAULT_ADDR", final)
+	}
+}
+
+func TestSettingLayersExplicit(t *testing.T) {
+	f := flag.Lookup("vault-addr")
+	envValues["vault-addr"] = "https://env:8200"
+	defer delete(envValues, "vault-addr")
+
+	layers := settingLayers(f, map[string]bool{"vault-addr": true})
+	if len(layers) != 3 {
+		t.Fatalf("layers = %+v, want default, env and flag", layers)
+	}
+	if layers[1].Source != "env VAULT_ADDR" || layers[2].Source != "flag -vault-addr" {
+		t.Errorf("layers = %+v, want env overridden by the flag", layers)
+	}
+}
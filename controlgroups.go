@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var controlGroupsFile = flag.String("control-groups", "", "JSON file of policy path patterns requiring a control group approval (Vault Enterprise)")
+
+// controlGroups loaded -control-groups, first matching entry wins
+var controlGroups []controlGroupRule
+
+// controlGroupRule control group required on policy paths matching Path
+type controlGroupRule struct {
+	// Path pattern matched against policy paths, * matches within a segment
+	Path string `json:"path"`
+	// TTL of the request awaiting approval, Vault's default when empty
+	TTL     string               `json:"ttl"`
+	Factors []controlGroupFactor `json:"factors"`
+}
+
+// controlGroupFactor identity approval required by a control group
+type controlGroupFactor struct {
+	Name       string   `json:"name"`
+	GroupNames []string `json:"group_names"`
+	Approvals  int      `json:"approvals"`
+}
+
+// loadControlGroups reads and validates the control groups file, an empty
+// path returns no control groups
+func loadControlGroups(file string) ([]controlGroupRule, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []controlGroupRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", file, err)
+	}
+
+	for i, rule := range rules {
+		if rule.Path == "" {
+			return nil, fmt.Errorf("control group %d: path is required", i)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("control group %q: %v", rule.Path, err)
+		}
+		if rule.TTL != "" {
+			if _, err := time.ParseDuration(rule.TTL); err != nil {
+				return nil, fmt.Errorf("control group %q: ttl: %v", rule.Path, err)
+			}
+		}
+		if len(rule.Factors) == 0 {
+			return nil, fmt.Errorf("control group %q: at least one factor is required", rule.Path)
+		}
+		for _, factor := range rule.Factors {
+			if factor.Name == "" || len(factor.GroupNames) == 0 || factor.Approvals < 1 {
+				return nil, fmt.Errorf("control group %q: factor %q needs a name, group_names and at least one approval", rule.Path, factor.Name)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// controlGroupFor returns the first control group whose pattern matches the
+// policy path, nil when none does
+func controlGroupFor(policyPath string) *controlGroupRule {
+	for i := range controlGroups {
+		if matched, _ := path.Match(controlGroups[i].Path, policyPath); matched {
+			return &controlGroups[i]
+		}
+	}
+	return nil
+}
+
+// enterpriseBuilds build metadata of Vault Enterprise versions, e.g. the ent
+// of 1.4.0+ent or 1.4.0+ent.hsm
+var enterpriseBuilds = map[string]bool{"ent": true, "prem": true, "pro": true}
+
+// isEnterpriseVersion reports whether version is a Vault Enterprise build,
+// its build metadata starting with one of enterpriseBuilds
+func isEnterpriseVersion(version string) bool {
+	plus := strings.Index(version, "+")
+	if plus < 0 {
+		return false
+	}
+	build := strings.SplitN(version[plus+1:], ".", 2)[0]
+	return enterpriseBuilds[build]
+}
+
+// checkEnterprise fails unless the Vault server runs Vault Enterprise,
+// open source Vault rejects policies with control groups
+func (vault *Vault) checkEnterprise() error {
+	health, err := vault.client.Sys().Health()
+	if err != nil {
+		return fmt.Errorf("reading Vault version: %v", err)
+	}
+	if health == nil || !isEnterpriseVersion(health.Version) {
+		return errors.New("control groups need Vault Enterprise")
+	}
+	return nil
+}
+
+// renderControlGroup writes the control_group block of a path stanza
+func renderControlGroup(rule *strings.Builder, group *controlGroupRule) {
+	rule.WriteString("  control_group = {\n")
+	if group.TTL != "" {
+		fmt.Fprintf(rule, "    ttl = %q\n", group.TTL)
+	}
+	for _, factor := range group.Factors {
+		groupNames := make([]string, len(factor.GroupNames))
+		for i, name := range factor.GroupNames {
+			groupNames[i] = strconv.Quote(name)
+		}
+
+		fmt.Fprintf(rule, "    factor %q {\n      identity {\n        group_names = [%s]\n        approvals = %d\n      }\n    }\n",
+			factor.Name, strings.Join(groupNames, ", "), factor.Approvals)
+	}
+	rule.WriteString("  }\n")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsEnterpriseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.4.0+ent", true},
+		{"1.4.0+prem", true},
+		{"1.4.0+pro", true},
+		{"1.4.0+ent.hsm", true},
+		{"1.4.0+prem.hsm", true},
+		{"1.13.2+ent.hsm.fips1402", true},
+		{"1.4.0", false},
+		{"1.4.0-beta1", false},
+		{"1.4.0+oss", false},
+		{"1.4.0+entirely", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := isEnterpriseVersion(test.version); got != test.want {
+			t.Errorf("isEnterpriseVersion(%q) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestRenderControlGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		group controlGroupRule
+		want  string
+	}{
+		{
+			"single factor",
+			controlGroupRule{
+				Path:    "secret/data/prod/*",
+				Factors: []controlGroupFactor{{Name: "approvers", GroupNames: []string{"security"}, Approvals: 1}},
+			},
+			`  control_group = {
+    factor "approvers" {
+      identity {
+        group_names = ["security"]
+        approvals = 1
+      }
+    }
+  }
+`,
+		},
+		{
+			"ttl and several factors",
+			controlGroupRule{
+				Path: "secret/data/prod/*",
+				TTL:  "4h",
+				Factors: []controlGroupFactor{
+					{Name: "leads", GroupNames: []string{"team-leads", "sre"}, Approvals: 2},
+					{Name: "security", GroupNames: []string{"security"}, Approvals: 1},
+				},
+			},
+			`  control_group = {
+    ttl = "4h"
+    factor "leads" {
+      identity {
+        group_names = ["team-leads", "sre"]
+        approvals = 2
+      }
+    }
+    factor "security" {
+      identity {
+        group_names = ["security"]
+        approvals = 1
+      }
+    }
+  }
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var rule strings.Builder
+		renderControlGroup(&rule, &test.group)
+		if rule.String() != test.want {
+			t.Errorf("%s: rendered\n%s\nwant\n%s", test.name, rule.String(), test.want)
+		}
+	}
+}
+
+func TestRenderPolicyControlGroup(t *testing.T) {
+	group := &controlGroupRule{
+		Path:    "secret/data/prod/*",
+		Factors: []controlGroupFactor{{Name: "approvers", GroupNames: []string{"security"}, Approvals: 1}},
+	}
+	stanzas := []policyStanza{
+		{Path: "secret/data/prod/shop/api/*", Capabilities: []string{"read"}, ControlGroup: group},
+		{Path: "secret/metadata/prod/shop/api", Capabilities: []string{"list"}},
+	}
+
+	want := `path "secret/data/prod/shop/api/*" {
+  capabilities = ["read"]
+  control_group = {
+    factor "approvers" {
+      identity {
+        group_names = ["security"]
+        approvals = 1
+      }
+    }
+  }
+}
+
+path "secret/metadata/prod/shop/api" {
+  capabilities = ["list"]
+}
+
+`
+	if got := renderPolicy(stanzas); got != want {
+		t.Errorf("rendered\n%s\nwant\n%s", got, want)
+	}
+}
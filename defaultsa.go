@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// defaultSARoleNameTmpl name of the shared role of a namespace's default
+// service account, the underscore cannot clash with a deployment name
+const defaultSARoleNameTmpl = "{{.Context}}{{sep}}{{.Namespace}}{{sep}}_default{{sep}}role"
+
+var defaultSAPolicy = flag.String("default-sa-policy", "", "existing policy attached to one shared role per namespace for workloads running as the default service account, instead of generating their own")
+
+// usesDefaultAccount reports whether the service's role is only bound to
+// the default service account
+func (service *Service) usesDefaultAccount() bool {
+	accounts := service.boundAccountNames()
+	return len(accounts) == 1 && accounts[0] == DefaultServiceAccountName
+}
+
+// defaultSAAccount returns the account of the shared default service account
+// role of the service's namespace
+func defaultSAAccount(service Service, audiences []string) Service {
+	account := namespaceService(service.Context, service.Namespace)
+	account.AccountName = DefaultServiceAccountName
+	account.Namespaces = []string{service.Namespace}
+	account.Audiences = audiences
+	return account
+}
+
+// defaultSARolePath returns the path of the shared default service account
+// role of the account's namespace
+func (account *Service) defaultSARolePath() (string, error) {
+	name := account.parseTemplate(defaultSARoleNameTmpl)
+	if name == "" {
+		return "", errors.New("something wrong with parsing default service account role template")
+	}
+	return roleAuthPath + name, nil
+}
+
+// defaultSARoleWriter writes each namespace's default service account role
+// once per run
+type defaultSARoleWriter struct {
+	vault     *Vault
+	audiences []string
+	// policies result of checking -default-sa-policy exists, per Vault namespace
+	policies map[string]error
+	written  map[string]error
+}
+
+// newDefaultSARoleWriter returns a defaultSARoleWriter using vault, binding
+// the roles to audiences
+func newDefaultSARoleWriter(vault *Vault, audiences []string) *defaultSARoleWriter {
+	return &defaultSARoleWriter{
+		vault:     vault,
+		audiences: audiences,
+		policies:  map[string]error{},
+		written:   map[string]error{},
+	}
+}
+
+// ensure writes the default service account role of the service's
+// namespace unless already written in this run, returning its path
+func (writer *defaultSARoleWriter) ensure(service Service) (string, error) {
+	account := defaultSAAccount(service, writer.audiences)
+	path, err := account.defaultSARolePath()
+	if err != nil {
+		return "", err
+	}
+
+	key := writer.vault.namespace + "|" + service.Namespace
+	err, ok := writer.written[key]
+	if !ok {
+		err = writer.write(path, account)
+		writer.written[key] = err
+	}
+	if err != nil {
+		return "", fmt.Errorf("default service account role of namespace %s: %v", service.Namespace, err)
+	}
+
+	return path, nil
+}
+
+// write writes the role at path for account, after checking the policy it
+// grants exists
+func (writer *defaultSARoleWriter) write(path string, account Service) error {
+	vault := writer.vault
+
+	err, ok := writer.policies[vault.namespace]
+	if !ok {
+		err = vault.checkPolicyExists(*defaultSAPolicy)
+		writer.policies[vault.namespace] = err
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := account.roleData(*defaultSAPolicy)
+	if err != nil {
+		return err
+	}
+	if vault.changes.skip(vault.objectKey("role", path), data) {
+		return nil
+	}
+
+	if err := vault.write(path, data); err != nil {
+		return err
+	}
+	if *verifyWrites {
+		if err := vault.verifyRole(path, data); err != nil {
+			return err
+		}
+	}
+
+	vault.changes.applied(vault.objectKey("role", path), data)
+	return nil
+}
+
+// checkPolicyExists fails when the policy name does not exist
+func (vault *Vault) checkPolicyExists(name string) error {
+	vault.use("sys/policy/"+name, "read")
+	rule, err := vault.client.Sys().GetPolicy(name)
+	if err != nil {
+		return fmt.Errorf("reading policy %s: %v", name, err)
+	}
+	if rule == "" {
+		return fmt.Errorf("policy %s does not exist", name)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var (
+	diffMode            = flag.Bool("diff", false, "compare the desired policies and roles with Vault and print the differences without writing")
+	ignoreDefaultInDiff = flag.Bool("ignore-default-in-diff", false, "leave the default policy out when comparing role policies")
+)
+
+// diffService returns the differences between the service's desired policy
+// and role and those stored in Vault, none when both are up to date
+func (vault *Vault) diffService(service Service) ([]string, error) {
+	var differences []string
+
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		return nil, err
+	}
+	policy := service.policyName()
+	if policy == "" {
+		return nil, errors.New("something wrong with parsing templates")
+	}
+
+	vault.use("sys/policy/"+policy, "read")
+	stored, err := vault.client.Sys().GetPolicy(policy)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy %s: %v", policy, err)
+	}
+	switch {
+	case stored == "":
+		differences = append(differences, fmt.Sprintf("policy %s is missing", policy))
+	case normalizePolicy(stored) != normalizePolicy(renderPolicy(stanzas)):
+		differences = append(differences, fmt.Sprintf("policy %s differs", policy))
+	}
+
+	// the role is compared with the service it was merged into
+	if service.MergedRole != "" {
+		return differences, nil
+	}
+
+	data, err := service.roleData(policy)
+	if err != nil {
+		return nil, err
+	}
+	path := service.rolePath()
+
+	vault.use(path, "read")
+	secret, err := vault.client.Logical().Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading role %s: %v", path, err)
+	}
+	if secret == nil {
+		return append(differences, fmt.Sprintf("role %s is missing", path)), nil
+	}
+	for _, mismatch := range roleMismatches(secret.Data, data) {
+		differences = append(differences, fmt.Sprintf("role %s: %s", path, mismatch))
+	}
+
+	return differences, nil
+}
+
+// roleMismatches returns every field of want stored with a different value
+func roleMismatches(stored, want map[string]interface{}) []string {
+	var mismatches []string
+	for field, value := range want {
+		got, wanted := normalizeRoleField(field, stored[field]), normalizeRoleField(field, value)
+		if got != wanted {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, want %q", field, got, wanted))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// normalizeRoleField returns the comparable form of a role field, without
+// the default policy when -ignore-default-in-diff is set
+func normalizeRoleField(field string, value interface{}) string {
+	if *ignoreDefaultInDiff && (field == "policies" || field == "token_policies") {
+		var policies []string
+		switch v := value.(type) {
+		case []string:
+			policies = v
+		case []interface{}:
+			for _, item := range v {
+				policies = append(policies, fmt.Sprint(item))
+			}
+		}
+
+		var kept []string
+		for _, policy := range policies {
+			if policy != "default" {
+				kept = append(kept, policy)
+			}
+		}
+		if policies != nil {
+			value = kept
+		}
+	}
+	return normalizeRoleValue(value)
+}
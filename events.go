@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventComponent source component recorded on emitted events
+const eventComponent = "kubernetes-service_accounts-2-vault-policies"
+
+var (
+	emitEvents            = flag.Bool("emit-events", false, "record the run summary as a Kubernetes Event on -event-object")
+	eventObject           = flag.String("event-object", "", "object the summary event is recorded on, as Kind/namespace/name, e.g. CronJob/vault/sync")
+	eventObjectAPIVersion = flag.String("event-object-api-version", "batch/v1beta1", "API version of -event-object")
+)
+
+// parseObjectReference parses a Kind/namespace/name reference
+func parseObjectReference(ref, apiVersion string) (corev1.ObjectReference, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return corev1.ObjectReference{}, fmt.Errorf("object reference %q should be Kind/namespace/name", ref)
+	}
+
+	return corev1.ObjectReference{
+		Kind:       parts[0],
+		Namespace:  parts[1],
+		Name:       parts[2],
+		APIVersion: apiVersion,
+	}, nil
+}
+
+// objectUID looks up the UID of the referenced object, kubectl describe
+// only lists events whose involved object carries it
+func objectUID(clientset kubernetes.Interface, ref corev1.ObjectReference) (string, error) {
+	prefix := "/apis/" + ref.APIVersion
+	if !strings.Contains(ref.APIVersion, "/") {
+		prefix = "/api/" + ref.APIVersion
+	}
+	resource, err := resourceName(clientset.Discovery(), ref.APIVersion, ref.Kind)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := clientset.Discovery().RESTClient().Get().
+		AbsPath(prefix, "namespaces", ref.Namespace, resource, ref.Name).
+		DoRaw()
+	if err != nil {
+		return "", err
+	}
+
+	var object struct {
+		Metadata struct {
+			UID string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", err
+	}
+
+	return object.Metadata.UID, nil
+}
+
+// serverResources lists the resources the API server serves in a group
+// version, implemented by the discovery client
+type serverResources interface {
+	ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error)
+}
+
+// resourceName returns the plural resource name of kind in apiVersion as
+// served by the API server, e.g. ingresses for Ingress or networkpolicies
+// for NetworkPolicy
+func resourceName(client serverResources, apiVersion, kind string) (string, error) {
+	resources, err := client.ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		return "", err
+	}
+
+	for _, resource := range resources.APIResources {
+		// subresources such as cronjobs/status share the kind
+		if resource.Kind == kind && !strings.Contains(resource.Name, "/") {
+			return resource.Name, nil
+		}
+	}
+	return "", fmt.Errorf("kind %s is not served in %s", kind, apiVersion)
+}
+
+// recordSummaryEvent records summary as an event on the referenced object,
+// a warning when any service failed
+func recordSummaryEvent(clientset kubernetes.Interface, ref corev1.ObjectReference, summary *runSummary) error {
+	uid, err := objectUID(clientset, ref)
+	if err != nil {
+		return fmt.Errorf("looking up %s %s/%s: %v", ref.Kind, ref.Namespace, ref.Name, err)
+	}
+	ref.UID = types.UID(uid)
+
+	eventType, reason := corev1.EventTypeNormal, "VaultPoliciesSynced"
+	if len(summary.Failures) > 0 {
+		eventType, reason = corev1.EventTypeWarning, "VaultPoliciesSyncFailed"
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    ref.Namespace,
+		},
+		InvolvedObject: ref,
+		Reason:         reason,
+		Message:        summary.String(),
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+	}
+
+	_, err = clientset.CoreV1().Events(ref.Namespace).Create(event)
+	return err
+}
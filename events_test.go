@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// staticResources serverResources serving a fixed list of group versions
+type staticResources []*metav1.APIResourceList
+
+func (resources staticResources) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	for _, list := range resources {
+		if list.GroupVersion == groupVersion {
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("the server could not find the requested resource")
+}
+
+func TestResourceName(t *testing.T) {
+	discovery := staticResources{
+		{
+			GroupVersion: "batch/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "cronjobs/status", Kind: "CronJob"},
+				{Name: "cronjobs", Kind: "CronJob"},
+			},
+		},
+		{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "networkpolicies", Kind: "NetworkPolicy"},
+			},
+		},
+		{
+			GroupVersion: "extensions/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "ingresses", Kind: "Ingress"},
+			},
+		},
+	}
+
+	tests := []struct {
+		apiVersion string
+		kind       string
+		want       string
+	}{
+		{"batch/v1beta1", "CronJob", "cronjobs"},
+		{"networking.k8s.io/v1", "NetworkPolicy", "networkpolicies"},
+		{"extensions/v1beta1", "Ingress", "ingresses"},
+	}
+
+	for _, test := range tests {
+		got, err := resourceName(discovery, test.apiVersion, test.kind)
+		if err != nil || got != test.want {
+			t.Errorf("resourceName(%s, %s) = %q, %v, want %q", test.apiVersion, test.kind, got, err, test.want)
+		}
+	}
+
+	if _, err := resourceName(discovery, "batch/v1beta1", "Job"); err == nil {
+		t.Error("Job resolved in batch/v1beta1")
+	}
+	if _, err := resourceName(discovery, "apps/v1", "Deployment"); err == nil {
+		t.Error("Deployment resolved in an unserved group version")
+	}
+}
+
+func TestParseObjectReference(t *testing.T) {
+	ref, err := parseObjectReference("CronJob/vault-system/vault-policies", "batch/v1beta1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Kind != "CronJob" || ref.Namespace != "vault-system" || ref.Name != "vault-policies" || ref.APIVersion != "batch/v1beta1" {
+		t.Errorf("reference = %+v", ref)
+	}
+
+	for _, value := range []string{"", "CronJob/vault-policies", "CronJob//vault-policies", "a/b/c/d"} {
+		if _, err := parseObjectReference(value, "batch/v1beta1"); err == nil {
+			t.Errorf("parseObjectReference(%q) accepted", value)
+		}
+	}
+}
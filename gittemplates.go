@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// templateGitTokenEnv environment variable holding the token of private
+// -template-git-url repositories
+const templateGitTokenEnv = "TEMPLATE_GIT_TOKEN"
+
+var (
+	templateGitURL   = flag.String("template-git-url", "", "Git repository to fetch template settings from at startup")
+	templateGitRef   = flag.String("template-git-ref", "main", "branch or tag of -template-git-url")
+	templateGitPath  = flag.String("template-git-path", "templates.json", "JSON file of template settings in -template-git-url")
+	templateGitUser  = flag.String("template-git-user", "x-access-token", "user authenticating with $"+templateGitTokenEnv+" to -template-git-url")
+	templateGitCache = flag.String("template-git-cache", "", "file keeping the last fetched template settings, used when fetching fails")
+)
+
+// gitTemplateFlags settings a -template-git-path file may set
+var gitTemplateFlags = map[string]bool{
+	"secret-path-template":        true,
+	"policy-suffix-template":      true,
+	"transit-key-template":        true,
+	"vault-namespace-template":    true,
+	"shared-policy-name-template": true,
+}
+
+// gitTemplateValues settings taken from Git, for -trace-config
+var gitTemplateValues = map[string]string{}
+
+// applyGitTemplates sets the template settings of -template-git-url which
+// were not given on the command line. When fetching fails the last cached
+// settings are used, or, unless -strict, the built-in defaults.
+func applyGitTemplates() error {
+	if *templateGitURL == "" {
+		return nil
+	}
+
+	content, err := fetchGitTemplates()
+	switch {
+	case err == nil && *templateGitCache != "":
+		if err := writeFileAtomic(*templateGitCache, content, 0600); err != nil {
+			fmt.Println("warning: caching templates:", err)
+		}
+	case err != nil && *templateGitCache != "":
+		cached, cacheErr := ioutil.ReadFile(*templateGitCache)
+		if cacheErr == nil {
+			fmt.Printf("warning: fetching templates: %v, using %s\n", err, *templateGitCache)
+			content, err = cached, nil
+		}
+	}
+	if err != nil {
+		if *strict {
+			return fmt.Errorf("fetching templates: %v", err)
+		}
+		fmt.Printf("warning: fetching templates: %v, using the built-in templates\n", err)
+		return nil
+	}
+
+	var settings map[string]string
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return fmt.Errorf("parsing %s: %v", *templateGitPath, err)
+	}
+
+	explicit := explicitFlags()
+	for name, value := range settings {
+		if !gitTemplateFlags[name] {
+			return fmt.Errorf("%s: %s is not a template setting", *templateGitPath, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		// set through the value, the flag still counts as not given
+		if err := flag.Lookup(name).Value.Set(value); err != nil {
+			return fmt.Errorf("%s: invalid %s: %v", *templateGitPath, name, err)
+		}
+		gitTemplateValues[name] = value
+	}
+
+	return nil
+}
+
+// fetchGitTemplates shallow-clones -template-git-ref of -template-git-url
+// and returns the content of -template-git-path
+func fetchGitTemplates() ([]byte, error) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command("git", "clone", "--quiet", "--depth", "1", "--branch", *templateGitRef, "--", *templateGitURL, dir)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	// the token goes into the environment, not the process list
+	if token := os.Getenv(templateGitTokenEnv); token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(*templateGitUser + ":" + token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git clone %s: %v: %s", *templateGitURL, err, strings.TrimSpace(string(output)))
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(*templateGitPath))
+	if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("-template-git-path %s is outside the repository", *templateGitPath)
+	}
+	return ioutil.ReadFile(path)
+}
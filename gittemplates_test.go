@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// gitTemplatesRepo returns a local Git repository committing content as
+// templates.json on branch main
+func gitTemplatesRepo(t *testing.T, content string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "templates-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "templates.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"checkout", "--quiet", "-b", "main"},
+		{"add", "templates.json"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "templates"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+	return dir
+}
+
+func TestApplyGitTemplates(t *testing.T) {
+	dir := gitTemplatesRepo(t, `{"secret-path-template": "{{.Context}}/{{.Namespace}}/{{.Labels.team}}/{{.Name}}"}`)
+	defer os.RemoveAll(dir)
+	defer setFlag(t, "template-git-url", "file://"+dir)()
+	defer setFlag(t, "secret-path-template", *secretPathTemplate)()
+	defer delete(gitTemplateValues, "secret-path-template")
+
+	if err := applyGitTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if *secretPathTemplate != "{{.Context}}/{{.Namespace}}/{{.Labels.team}}/{{.Name}}" {
+		t.Errorf("-secret-path-template = %q, want the value from Git", *secretPathTemplate)
+	}
+	if explicitFlags()["secret-path-template"] {
+		t.Error("-secret-path-template from Git reported as a command line flag")
+	}
+}
+
+func TestApplyGitTemplatesUnknownKey(t *testing.T) {
+	dir := gitTemplatesRepo(t, `{"policy-name-template": "{{.Name}}"}`)
+	defer os.RemoveAll(dir)
+	defer setFlag(t, "template-git-url", "file://"+dir)()
+
+	if err := applyGitTemplates(); err == nil {
+		t.Error("policy-name-template, which cannot come from Git, was accepted")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var (
+	groupByIdentity    = flag.Bool("group-by-identity", false, "write one policy and role per shared identity instead of per deployment for annotated workloads")
+	identityAnnotation = flag.String("identity-annotation", "vault.io/identity", "deployment or service account annotation naming the shared identity")
+)
+
+// identityNameRegex identities are named like Kubernetes objects, so they
+// render valid Vault names and cannot take a reserved underscore segment
+var identityNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+// deploymentIdentity returns the deployment's identity annotation, falling
+// back to the annotation of its service account, empty when neither is set
+func deploymentIdentity(deployment appsv1.Deployment, accountName string, accounts *serviceAccountCache) (string, error) {
+	identity := deployment.GetAnnotations()[*identityAnnotation]
+	if identity == "" {
+		account, err := accounts.get(deployment.GetNamespace(), accountName)
+		if err != nil || account == nil {
+			return "", err
+		}
+		identity = account.GetAnnotations()[*identityAnnotation]
+	}
+
+	if identity != "" && !identityNameRegex.MatchString(identity) {
+		return "", fmt.Errorf("invalid %s annotation %q, should consist of lower case alphanumerics, - or .", *identityAnnotation, identity)
+	}
+	return identity, nil
+}
+
+// groupServices merges services sharing an identity into a single service
+// named after the identity, bound to every member's service account and
+// namespace. Services without an identity are returned unchanged, failed
+// identities are returned by name.
+func groupServices(services []Service) ([]Service, map[string]error) {
+	var grouped []Service
+	errs := map[string]error{}
+	members := map[string][]Service{}
+	var identities []string
+
+	for _, service := range services {
+		if service.Identity == "" {
+			grouped = append(grouped, service)
+			continue
+		}
+		if _, ok := members[service.Identity]; !ok {
+			identities = append(identities, service.Identity)
+		}
+		members[service.Identity] = append(members[service.Identity], service)
+	}
+
+	sort.Strings(identities)
+	for _, identity := range identities {
+		service, err := mergeIdentity(identity, members[identity])
+		if err != nil {
+			errs[identity] = err
+			continue
+		}
+		grouped = append(grouped, service)
+	}
+
+	return grouped, errs
+}
+
+// mergeIdentity returns the single service of identity shared by members
+func mergeIdentity(identity string, members []Service) (Service, error) {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Namespace+"/"+members[i].Name < members[j].Namespace+"/"+members[j].Name
+	})
+
+	first := members[0]
+	accounts := map[string]bool{}
+	namespaces := map[string]bool{}
+
+	for _, member := range members {
+		// settings which cannot be merged must agree
+		if !mergeable(first, member) {
+			return Service{}, fmt.Errorf("identity %s: %s/%s and %s/%s differ in tier, phase, audiences or VaultAccess", identity, first.Namespace, first.Name, member.Namespace, member.Name)
+		}
+		for _, account := range member.boundAccountNames() {
+			accounts[account] = true
+		}
+		for _, namespace := range member.Namespaces {
+			namespaces[namespace] = true
+		}
+	}
+
+	// joining an identity grants its policy in every member namespace
+	if err := checkNamespaceGroup(sortedKeys(namespaces)); err != nil {
+		return Service{}, fmt.Errorf("identity %s: %v", identity, err)
+	}
+
+	return Service{
+		Name:         identity,
+		Context:      first.Context,
+		Namespace:    first.Namespace,
+		AccountName:  first.AccountName,
+		AccountNames: sortedKeys(accounts),
+		Namespaces:   sortedKeys(namespaces),
+		Audiences:    first.Audiences,
+		Tier:         first.Tier,
+		Phase:        first.Phase,
+		Identity:     identity,
+		Access:       first.Access,
+		Labels:       first.Labels,
+	}, nil
+}
+
+// mergeable reports whether two services agree on the settings which cannot
+// be merged into a single policy and role
+func mergeable(a, b Service) bool {
+	return a.Tier == b.Tier && a.phase() == b.phase() && strings.Join(a.Audiences, ",") == strings.Join(b.Audiences, ",") && reflect.DeepEqual(a.Access, b.Access)
+}
+
+// sortedKeys returns the keys of set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedErrorKeys returns the keys of errs in order
+func sortedErrorKeys(errs map[string]error) []string {
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// identityServices returns api in shop and worker in billing, both of identity
+// payments
+func identityServices() []Service {
+	api := testService("shop", "api")
+	api.Identity = "payments"
+	worker := testService("billing", "worker")
+	worker.Identity = "payments"
+	return []Service{testService("shop", "web"), worker, api}
+}
+
+func TestGroupServicesAcrossNamespaces(t *testing.T) {
+	grouped, errs := groupServices(identityServices())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(grouped) != 2 || grouped[0].Name != "web" {
+		t.Fatalf("grouped = %+v, want web and the payments identity", grouped)
+	}
+
+	identity := grouped[1]
+	if identity.Name != "payments" || identity.Namespace != "billing" {
+		t.Errorf("identity %s/%s, want billing/payments after its first member", identity.Namespace, identity.Name)
+	}
+	if want := []string{"billing", "shop"}; !reflect.DeepEqual(identity.Namespaces, want) {
+		t.Errorf("namespaces = %v, want %v", identity.Namespaces, want)
+	}
+	if want := []string{"api", "worker"}; !reflect.DeepEqual(identity.AccountNames, want) {
+		t.Errorf("service accounts = %v, want %v", identity.AccountNames, want)
+	}
+}
+
+func TestGroupServicesNamespaceGroups(t *testing.T) {
+	defer setFlag(t, "namespace-groups", "shop,shop-jobs;billing")()
+
+	grouped, errs := groupServices(identityServices())
+	if errs["payments"] == nil {
+		t.Error("shop joined the payments identity of billing outside its namespace group")
+	}
+	if len(grouped) != 1 || grouped[0].Name != "web" {
+		t.Errorf("grouped = %+v, want only web", grouped)
+	}
+}
+
+func TestGroupServicesMismatch(t *testing.T) {
+	services := identityServices()
+	services[1].Tier = "prod"
+
+	if _, errs := groupServices(services); errs["payments"] == nil {
+		t.Error("members differing in tier were grouped")
+	}
+}
+
+func TestIdentityNames(t *testing.T) {
+	services := identityServices()
+	// a deployment named like the identity's members joined by the separator
+	services = append(services, testService("shop", "payments"))
+	grouped, errs := groupServices(services)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	identity := grouped[len(grouped)-1]
+	if policy := identity.policyName(); policy != "prod-_identity-payments" {
+		t.Errorf("policy = %q, want prod-_identity-payments", policy)
+	}
+	if role := identity.rolePath(); role != "auth/kubernetes/role/prod-_identity-payments-role" {
+		t.Errorf("role = %q, want auth/kubernetes/role/prod-_identity-payments-role", role)
+	}
+	if err := checkNameCollisions(grouped); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeploymentIdentity(t *testing.T) {
+	tests := []struct {
+		identity string
+		valid    bool
+	}{
+		{"payments", true},
+		{"shop-api", true},
+		{"payments.v2", true},
+		{"Payments", false},
+		{"_default", false},
+		{"shop/api", false},
+		{"payments-", false},
+	}
+
+	for _, test := range tests {
+		deployment := annotatedDeployment("shop", "api", map[string]string{*identityAnnotation: test.identity})
+		identity, err := deploymentIdentity(deployment, "api", nil)
+		if test.valid && (err != nil || identity != test.identity) {
+			t.Errorf("%q: got %q, %v", test.identity, identity, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%q: accepted", test.identity)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+var sinceReport = flag.String("since-report", "", "file with the content hashes of the last run, only objects whose hash changed are written")
+
+// contentFlags flags changing the content of the policies and roles written
+// or where they are written, the only ones in the config hash. Flags
+// selecting workloads or affecting only logging, reports, timeouts and
+// other output are left out.
+var contentFlags = map[string]bool{
+	"context":                     true,
+	"vault-addr":                  true,
+	"vault-namespace":             true,
+	"vault-namespace-template":    true,
+	"kv-mount":                    true,
+	"kv-version":                  true,
+	"name-strategy":               true,
+	"name-separator":              true,
+	"secret-path-template":        true,
+	"policy-suffix-template":      true,
+	"missing-label-default":       true,
+	"default-phase":               true,
+	"tier-overrides":              true,
+	"control-groups":              true,
+	"transit":                     true,
+	"transit-only":                true,
+	"transit-mount":               true,
+	"transit-key-template":        true,
+	"version-management":          true,
+	"list-metadata":               true,
+	"bound-audiences":             true,
+	"token-explicit-max-ttl":      true,
+	"no-default-policy":           true,
+	"shared-namespace-policy":     true,
+	"shared-policy-name-template": true,
+	"default-sa-policy":           true,
+	"group-by-identity":           true,
+	"identity-annotation":         true,
+	"policy-per-sa":               true,
+	"access-crd":                  true,
+	"access-crd-resource":         true,
+	"access-crd-subtree-template": true,
+	"access-crd-policies":         true,
+}
+
+// hashReport content hashes of the objects applied by a run
+type hashReport struct {
+	RunID      string            `json:"run_id"`
+	ConfigHash string            `json:"config_hash"`
+	Objects    map[string]string `json:"objects"`
+}
+
+// changeSet compares the objects of this run with the prior report and
+// collects the hashes of the objects applied
+type changeSet struct {
+	configHash string
+	prior      map[string]string
+	current    map[string]string
+	unchanged  int
+}
+
+// loadChangeSet reads the prior report at path, a missing file starts
+// from an empty report
+func loadChangeSet(path string) (*changeSet, error) {
+	changes := &changeSet{
+		configHash: configHash(),
+		prior:      map[string]string{},
+		current:    map[string]string{},
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return changes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var report hashReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if report.Objects != nil {
+		changes.prior = report.Objects
+	}
+
+	return changes, nil
+}
+
+// configHash returns the hash of every contentFlags setting
+func configHash() string {
+	var settings []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if contentFlags[f.Name] {
+			settings = append(settings, f.Name+"="+f.Value.String())
+		}
+	})
+	sort.Strings(settings)
+
+	hash := sha256.New()
+	for _, setting := range settings {
+		fmt.Fprintln(hash, setting)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// hash returns the hash of object key with content, folding in the config
+// hash so a config or template change invalidates every object
+func (changes *changeSet) hash(key string, content interface{}) string {
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		// unhashable content is always written
+		return ""
+	}
+
+	hash := sha256.New()
+	fmt.Fprintln(hash, changes.configHash)
+	fmt.Fprintln(hash, key)
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// skip reports whether object key is unchanged since the prior report and
+// need not be written; a nil changeSet writes everything
+func (changes *changeSet) skip(key string, content interface{}) bool {
+	if changes == nil {
+		return false
+	}
+
+	hash := changes.hash(key, content)
+	if hash == "" || changes.prior[key] != hash {
+		return false
+	}
+
+	changes.current[key] = hash
+	changes.unchanged++
+	return true
+}
+
+// applied records object key as written with content
+func (changes *changeSet) applied(key string, content interface{}) {
+	if changes == nil {
+		return
+	}
+
+	if hash := changes.hash(key, content); hash != "" {
+		changes.current[key] = hash
+	}
+}
+
+// save atomically writes the hashes of the objects applied by this run to path
+func (changes *changeSet) save(path string) error {
+	content, err := json.MarshalIndent(hashReport{
+		RunID:      runID,
+		ConfigHash: changes.configHash,
+		Objects:    changes.current,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, content, 0600)
+}
+
+// objectKey identifies an object of kind in the current Vault namespace
+func (vault *Vault) objectKey(kind, name string) string {
+	if vault.namespace == "" {
+		return kind + "/" + name
+	}
+	return vault.namespace + ":" + kind + "/" + name
+}
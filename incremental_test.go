@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestContentFlagsDefined(t *testing.T) {
+	for name := range contentFlags {
+		if flag.Lookup(name) == nil {
+			t.Errorf("content flag -%s is not defined", name)
+		}
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	base := configHash()
+
+	output := map[string]string{
+		"junit":                   "report.xml",
+		"print-used-capabilities": "true",
+		"k8s-qps":                 "50",
+		"vault-timeout":           "5s",
+		"run-id":                  "nightly",
+		"since-report":            "hashes.json",
+		"randomize-order":         "true",
+		"selector":                "app=api",
+		"strict":                  "true",
+	}
+	for name, value := range output {
+		func() {
+			defer setFlag(t, name, value)()
+			if configHash() != base {
+				t.Errorf("-%s %s changed the config hash", name, value)
+			}
+		}()
+	}
+
+	content := map[string]string{
+		"kv-mount":             "kv",
+		"secret-path-template": "{{.Context}}/{{.Namespace}}/apps/{{.Name}}",
+		"name-separator":       "_",
+		"version-management":   "true",
+		"vault-addr":           "https://vault-dr.example.com:8200",
+	}
+	for name, value := range content {
+		func() {
+			defer setFlag(t, name, value)()
+			if configHash() == base {
+				t.Errorf("-%s %s left the config hash unchanged", name, value)
+			}
+		}()
+	}
+}
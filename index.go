@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+var (
+	writeIndex = flag.Bool("write-index", false, "after applying, replace a single KV index entry listing every managed policy")
+	indexPath  = flag.String("index-path", "_index/policies", "path below -kv-mount the index is written to")
+)
+
+// writeIndex replaces the index entry with the markers of every policy
+// managed by this run. When keep is given, entries of the prior index for
+// which it returns true are carried over unless this run rewrote them.
+func (vault *Vault) writeIndex(markers []marker, keep func(entry map[string]interface{}) bool) error {
+	policies := map[string]interface{}{}
+
+	if keep != nil {
+		prior, err := vault.readKV(strings.Trim(*indexPath, "/"))
+		if err != nil {
+			return err
+		}
+		priorPolicies, _ := prior["policies"].(map[string]interface{})
+		for name, value := range priorPolicies {
+			if entry, ok := value.(map[string]interface{}); ok && keep(entry) {
+				policies[name] = entry
+			}
+		}
+	}
+
+	for _, m := range markers {
+		policies[m.Policy] = m.data()
+	}
+
+	data := map[string]interface{}{
+		"run_id":   runID,
+		"updated":  time.Now().UTC().Format(time.RFC3339),
+		"count":    len(policies),
+		"policies": policies,
+	}
+
+	return vault.writeKV(strings.Trim(*indexPath, "/"), data)
+}
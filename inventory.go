@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var inventoryMetrics = flag.String("inventory-metrics", "", "write discovered workload counts as Prometheus textfile gauges to this file and exit, without contacting Vault")
+
+// labelValueEscaper escapes Prometheus label values
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeInventoryMetricsFile atomically replaces path with the inventory of
+// deployments, so the textfile collector never reads a partial file
+func writeInventoryMetricsFile(path string, deployments []appsv1.Deployment) error {
+	var content bytes.Buffer
+	if err := writeInventoryMetrics(&content, deployments); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content.Bytes(), 0644)
+}
+
+// writeInventoryMetrics writes workload counts per namespace, per service
+// account and per kind in the Prometheus exposition format
+func writeInventoryMetrics(w io.Writer, deployments []appsv1.Deployment) error {
+	namespaces := map[string]int{}
+	accounts := map[string]int{}
+	kinds := map[string]int{"Deployment": len(deployments)}
+
+	for _, deployment := range deployments {
+		account := deployment.Spec.Template.Spec.ServiceAccountName
+		if account == "" {
+			account = DefaultServiceAccountName
+		}
+		namespaces[fmt.Sprintf(`namespace="%s"`, labelValueEscaper.Replace(deployment.GetNamespace()))]++
+		accounts[fmt.Sprintf(`namespace="%s",service_account="%s"`, labelValueEscaper.Replace(deployment.GetNamespace()), labelValueEscaper.Replace(account))]++
+	}
+
+	kindLabels := map[string]int{}
+	for kind, count := range kinds {
+		kindLabels[fmt.Sprintf(`kind="%s"`, kind)] = count
+	}
+
+	gauges := []struct {
+		name, help string
+		values     map[string]int
+	}{
+		{"vault_policies_inventory_namespace_workloads", "Workloads discovered per namespace.", namespaces},
+		{"vault_policies_inventory_service_account_workloads", "Workloads discovered per service account.", accounts},
+		{"vault_policies_inventory_kind_workloads", "Workloads discovered per kind.", kindLabels},
+	}
+
+	for _, gauge := range gauges {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name); err != nil {
+			return err
+		}
+
+		labels := make([]string, 0, len(gauge.values))
+		for label := range gauge.values {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		for _, label := range labels {
+			if _, err := fmt.Fprintf(w, "%s{%s} %d\n", gauge.name, label, gauge.values[label]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+var junitReport = flag.String("junit", "", "write the outcome of every service as a JUnit XML report to this file")
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSeconds formats elapsed as JUnit expects
+func junitSeconds(elapsed time.Duration) string {
+	return fmt.Sprintf("%.3f", elapsed.Seconds())
+}
+
+// writeJUnitReport writes every service of summary as a test case to path
+func writeJUnitReport(path string, summary *runSummary) error {
+	suite := junitTestSuite{
+		Name:     "vault-policies run " + summary.RunID,
+		Tests:    summary.Services,
+		Failures: len(summary.Failures),
+		Skipped:  summary.Skipped,
+	}
+
+	var total time.Duration
+	for _, result := range summary.Results {
+		total += result.Elapsed
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: "vault-policies",
+			Time:      junitSeconds(result.Elapsed),
+		}
+
+		switch result.Status {
+		case statusFailed:
+			testCase.Failure = &junitMessage{Message: result.Message, Text: result.Message}
+		case statusSkipped:
+			testCase.Skipped = &junitMessage{Message: result.Message}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = junitSeconds(total)
+
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append([]byte(xml.Header), content...), 0644)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var noAutodetectKV = flag.Bool("no-autodetect-kv", false, "use -kv-mount and -kv-version as given instead of detecting the KV engine from sys/mounts")
+
+// kvMountVersion returns the KV version of a sys/mounts entry, 0 when it is
+// not a KV engine
+func kvMountVersion(mountType string, options map[string]string) int {
+	switch mountType {
+	case "generic":
+		return 1
+	case "kv":
+		if options["version"] == "2" {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// detectKV sets -kv-mount and -kv-version from the KV engines mounted in
+// Vault: the only engine, or the one selected with -kv-mount. Flags given
+// explicitly win. A token which may not read sys/mounts, or no engine, falls
+// back to the flags; several engines need -kv-mount.
+func (vault *Vault) detectKV() error {
+	vault.use("sys/mounts", "read")
+	mounts, err := vault.client.Sys().ListMounts()
+	if vaultStatusCode(err) == 403 {
+		fmt.Printf("warning: cannot read sys/mounts to detect the KV engine, using -kv-mount %s -kv-version %d\n", strings.Trim(*kvMount, "/"), *kvVersion)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("listing Vault mounts: %v", err)
+	}
+
+	engines := map[string]int{}
+	for path, mount := range mounts {
+		if mount == nil {
+			continue
+		}
+		if version := kvMountVersion(mount.Type, mount.Options); version > 0 {
+			engines[strings.Trim(path, "/")] = version
+		}
+	}
+
+	return applyKVEngine(engines, explicitFlags())
+}
+
+// applyKVEngine sets -kv-mount and -kv-version from the mounted KV engines'
+// versions by path, unless the flags named in explicit were given
+func applyKVEngine(engines map[string]int, explicit map[string]bool) error {
+	mount := strings.Trim(*kvMount, "/")
+	if !explicit["kv-mount"] {
+		if len(engines) == 0 {
+			fmt.Printf("warning: cannot detect the KV engine, none is mounted, using -kv-mount %s\n", mount)
+			return nil
+		}
+		if len(engines) > 1 {
+			var paths []string
+			for path := range engines {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			return fmt.Errorf("found %d KV engines (%s), select one with -kv-mount", len(engines), strings.Join(paths, ", "))
+		}
+		for path := range engines {
+			mount = path
+		}
+	}
+
+	version, ok := engines[mount]
+	if !ok {
+		return fmt.Errorf("-kv-mount %s is not a KV engine mounted in Vault", mount)
+	}
+
+	if explicit["kv-version"] && *kvVersion != version {
+		return fmt.Errorf("-kv-version %d does not match the KV version %d of %s", *kvVersion, version, mount)
+	}
+
+	*kvMount = mount
+	*kvVersion = version
+	fmt.Println("detected KV engine", mount, "version", version)
+	return nil
+}
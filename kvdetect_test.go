@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mountsServer returns a Vault server answering sys/mounts with status and body
+func mountsServer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+}
+
+// kvMounts returns a sys/mounts response body of mounts, path to KV version
+func kvMounts(mounts map[string]int) string {
+	var entries []string
+	for path, version := range mounts {
+		entries = append(entries, fmt.Sprintf(`%q: {"type": "kv", "options": {"version": "%d"}}`, path+"/", version))
+	}
+	entries = append(entries, `"sys/": {"type": "system"}`)
+	return `{"data": {` + strings.Join(entries, ", ") + `}}`
+}
+
+func TestDetectKV(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		mounts  map[string]int
+		want    string
+		version int
+		err     string
+	}{
+		{"single engine", 200, map[string]int{"kv": 1}, "kv", 1, ""},
+		{"no engine", 200, map[string]int{}, "secret", 2, ""},
+		{"several engines", 200, map[string]int{"kv": 1, "secret": 2}, "", 0, "found 2 KV engines (kv, secret)"},
+		{"permission denied", 403, nil, "secret", 2, ""},
+		{"server error", 500, nil, "", 0, "listing Vault mounts"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setFlag(t, "kv-mount", "secret")()
+			defer setFlag(t, "kv-version", "2")()
+
+			body := `{"errors": ["permission denied"]}`
+			if test.mounts != nil {
+				body = kvMounts(test.mounts)
+			}
+			server := mountsServer(test.status, body)
+			defer server.Close()
+
+			vault, err := NewVaultClient(server.URL, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = vault.detectKV()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *kvMount != test.want || *kvVersion != test.version {
+				t.Errorf("detected %s version %d, want %s version %d", *kvMount, *kvVersion, test.want, test.version)
+			}
+		})
+	}
+}
+
+func TestApplyKVEngineExplicit(t *testing.T) {
+	engines := map[string]int{"kv": 1, "secret": 2}
+
+	tests := []struct {
+		name     string
+		mount    string
+		version  string
+		explicit map[string]bool
+		want     int
+		err      string
+	}{
+		{"-kv-mount", "kv", "2", map[string]bool{"kv-mount": true}, 1, ""},
+		{"matching -kv-version", "secret", "2", map[string]bool{"kv-mount": true, "kv-version": true}, 2, ""},
+		{"mismatching -kv-version", "kv", "2", map[string]bool{"kv-mount": true, "kv-version": true}, 0, "does not match"},
+		{"unknown -kv-mount", "other", "2", map[string]bool{"kv-mount": true}, 0, "is not a KV engine"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setFlag(t, "kv-mount", test.mount)()
+			defer setFlag(t, "kv-version", test.version)()
+
+			err := applyKVEngine(engines, test.explicit)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *kvMount != test.mount || *kvVersion != test.want {
+				t.Errorf("detected %s version %d, want %s version %d", *kvMount, *kvVersion, test.mount, test.want)
+			}
+		})
+	}
+}
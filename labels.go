@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var (
+	secretPathTemplate  = flag.String("secret-path-template", secretPathTmpl, "template of the service's secret subtree below the KV mount, may use {{.Labels.<key>}}")
+	missingLabelDefault = flag.String("missing-label-default", "", "value of labels referenced by templates which a deployment does not have, such deployments fail when empty")
+)
+
+// labelKeyRegex characters replaced in label keys to make them template
+// identifiers
+var labelKeyRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// labelReferenceRegex references of labels in templates
+var labelReferenceRegex = regexp.MustCompile(`\.Labels\.([A-Za-z0-9_]+)`)
+
+// sanitizeLabelKey returns key usable as {{.Labels.<key>}}: every character
+// other than letters, digits and underscores becomes an underscore, e.g.
+// app.kubernetes.io/part-of becomes app_kubernetes_io_part_of
+func sanitizeLabelKey(key string) string {
+	key = labelKeyRegex.ReplaceAllString(key, "_")
+	if key != "" && key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+	return key
+}
+
+// templateLabels returns the labels of a deployment by sanitized key,
+// filling labels referenced by the templates which it does not have with
+// -missing-label-default
+func templateLabels(labels map[string]string) (map[string]string, error) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// keys sanitized alike keep the value of the first in order
+	sanitized := map[string]string{}
+	for _, key := range keys {
+		if _, ok := sanitized[sanitizeLabelKey(key)]; !ok {
+			sanitized[sanitizeLabelKey(key)] = labels[key]
+		}
+	}
+
+	for _, key := range referencedLabels() {
+		if _, ok := sanitized[key]; ok {
+			continue
+		}
+		if *missingLabelDefault == "" {
+			return nil, fmt.Errorf("label %s referenced by the templates is missing", key)
+		}
+		sanitized[key] = *missingLabelDefault
+	}
+
+	return sanitized, nil
+}
+
+// referencedLabels returns the sanitized label keys the configurable
+// templates reference
+func referencedLabels() []string {
+	set := map[string]bool{}
+	for _, tmpl := range []string{*secretPathTemplate, *policySuffixTemplate, *transitKeyTemplate, *vaultNamespaceTemplate} {
+		for _, match := range labelReferenceRegex.FindAllStringSubmatch(tmpl, -1) {
+			set[match[1]] = true
+		}
+	}
+	return sortedKeys(set)
+}
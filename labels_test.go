@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeLabelKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"app", "app"},
+		{"app.kubernetes.io/part-of", "app_kubernetes_io_part_of"},
+		{"team_name", "team_name"},
+		{"cost-center", "cost_center"},
+		{"1password", "_1password"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := sanitizeLabelKey(test.key); got != test.want {
+			t.Errorf("sanitizeLabelKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestTemplateLabels(t *testing.T) {
+	defer setFlag(t, "secret-path-template", "{{.Context}}/{{.Namespace}}/{{.Labels.app_kubernetes_io_part_of}}/{{.Name}}")()
+
+	labels, err := templateLabels(map[string]string{
+		"app.kubernetes.io/part-of": "checkout",
+		"app_kubernetes_io/part-of": "other",
+		"tier":                      "web",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// app.kubernetes.io/part-of sorts before app_kubernetes_io/part-of
+	want := map[string]string{"app_kubernetes_io_part_of": "checkout", "tier": "web"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %v, want %v", labels, want)
+	}
+}
+
+func TestTemplateLabelsMissing(t *testing.T) {
+	defer setFlag(t, "secret-path-template", "{{.Context}}/{{.Namespace}}/{{.Labels.team}}/{{.Name}}")()
+
+	if _, err := templateLabels(map[string]string{"app": "api"}); err == nil {
+		t.Error("missing referenced label accepted without -missing-label-default")
+	}
+
+	defer setFlag(t, "missing-label-default", "unowned")()
+	labels, err := templateLabels(map[string]string{"app": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"app": "api", "team": "unowned"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %v, want %v", labels, want)
+	}
+}
+
+func TestSecretPathLabels(t *testing.T) {
+	defer setFlag(t, "secret-path-template", "{{.Context}}/{{.Namespace}}/{{.Labels.app_kubernetes_io_part_of}}/{{.Name}}")()
+
+	service := testService("shop", "api")
+	service.Labels = map[string]string{"app_kubernetes_io_part_of": "checkout"}
+	if got := names.SecretPath(service); got != "prod/shop/checkout/api" {
+		t.Errorf("secret path = %q, want prod/shop/checkout/api", got)
+	}
+}
@@ -7,11 +7,17 @@ import (
 	"fmt"
 	"html/template"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/hashicorp/vault/api"
@@ -23,94 +29,660 @@ type Service struct {
 	Context     string
 	Namespace   string
 	AccountName string
+	// Namespaces the role is bound to, always including Namespace
+	Namespaces []string
+	// Audiences the service account token must be issued for, if any
+	Audiences []string
+	// Tier selecting the service's -tier-overrides entry, if any
+	Tier string
+	// Identity shared by grouped services, names their policy and role
+	Identity string
+	// AccountNames the role is bound to when more than AccountName
+	AccountNames []string
+	// Phase of the service's secrets, -default-phase when empty
+	Phase string
+	// Labels of the deployment by sanitized key, see sanitizeLabelKey
+	Labels map[string]string
+	// Access declared by the service account's VaultAccess resource, if any
+	Access *accessSpec
+	// Deployments sharing the service when grouped with -policy-per-sa, each
+	// with its own secret subtree
+	Deployments []string
+	// MergedPolicies policies of services whose bindings were merged into
+	// this service's role
+	MergedPolicies []string
+	// MergedRole path of the role this service's policy was merged into
+	MergedRole string
 }
 
 // Vault vault client
 type Vault struct {
-	*api.Client
+	// client the Vault API client, unexported so that writes cannot bypass
+	// write, delete and putPolicy
+	client *api.Client
+	// ReadOnly refuses every write, set for modes which must only read
+	ReadOnly bool
+	// changes skips objects unchanged since -since-report, nil writes all
+	changes *changeSet
+	// namespace the Vault Enterprise namespace currently used
+	namespace string
+	// namespaces result of checking each templated Vault namespace exists
+	namespaces map[string]error
+	// used capabilities of the paths called, for -print-used-capabilities
+	used usedCapabilities
 }
 
-var vaultAddr = os.Getenv("VAULT_ADDR")
+// ErrReadOnly returned for writes attempted through a read-only client
+var ErrReadOnly = errors.New("refusing to write to Vault in a read-only mode")
+
+var (
+	kubeconfig      = flag.String("kubeconfig", "", "(optional) path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config")
+	kubeContext     = flag.String("context", "", "(optional) kubeconfig context to use instead of the current one")
+	k8sQPS          = flag.Float64("k8s-qps", 5, "queries per second to the Kubernetes API server, client-go's default is 5")
+	k8sBurst        = flag.Int("k8s-burst", 10, "burst of queries to the Kubernetes API server, client-go's default is 10")
+	vaultAddr       = flag.String("vault-addr", "", "Vault server address (env VAULT_ADDR)")
+	traceConfig     = flag.Bool("trace-config", false, "print where every setting's value came from and exit")
+	boundAudiences  = flag.String("bound-audiences", "", "comma-separated audiences service account tokens must be issued for")
+	selector        = flag.String("selector", "", "label selector restricting the deployments processed")
+	scopeToSelector = flag.Bool("scope-to-selector", false, "restrict run-wide changes such as the index to the workloads matching -selector")
+	strict          = flag.Bool("strict", false, "fail services on problems which are otherwise only warned about")
+	nameSeparator   = flag.String("name-separator", "-", "separator between the segments of generated names, one or more of - _ .")
+	explicitMaxTTL  = flag.Duration("token-explicit-max-ttl", 0, "hard limit on the lifetime of tokens issued by the roles, including renewals, none when 0")
+	noDefaultPolicy = flag.Bool("no-default-policy", false, "do not attach the default policy to roles and the tokens they issue")
+)
+
+// nameSeparatorRegex separators keeping generated names valid Vault role and
+// policy names, which cannot contain slashes
+var nameSeparatorRegex = regexp.MustCompile(`^[-_.]+$`)
 
 // DefaultServiceAccountName default service account name
 const DefaultServiceAccountName = "default"
 
+// BoundNamespacesAnnotation deployment annotation listing additional
+// namespaces (comma-separated) the service account role is bound to
+const BoundNamespacesAnnotation = "vault.io/bound-namespaces"
+
+// BoundAudiencesAnnotation deployment annotation overriding -bound-audiences
+const BoundAudiencesAnnotation = "vault.io/bound-audiences"
+
 func main() {
-	// connection to the API server
-	//namespace := "default"
+	flag.Parse()
 
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	if err := applyEnvDefaults(); err != nil {
+		panic(err.Error())
+	}
+
+	if err := applyGitTemplates(); err != nil {
+		panic(err.Error())
+	}
+
+	runID = *runIDFlag
+	if runID == "" {
+		runID = newRunID()
+	}
+
+	audiences, err := splitAudiences(*boundAudiences)
+	if err != nil {
+		panic(fmt.Sprintf("invalid -bound-audiences: %v", err))
+	}
+
+	var eventRef corev1.ObjectReference
+	if *emitEvents {
+		eventRef, err = parseObjectReference(*eventObject, *eventObjectAPIVersion)
+		if err != nil {
+			panic(fmt.Sprintf("invalid -event-object: %v", err))
+		}
+	}
+
+	if !nameSeparatorRegex.MatchString(*nameSeparator) {
+		panic(fmt.Sprintf("invalid -name-separator %q, should consist of - _ or .", *nameSeparator))
+	}
+
+	if _, err := splitList(*allowedMountPrefixes); err != nil {
+		panic(fmt.Sprintf("invalid -allowed-mount-prefixes: %v", err))
+	}
+
+	if *scopeToSelector && *selector == "" && *ownerKind == "" {
+		panic("-scope-to-selector needs -selector or -owner-kind")
+	}
+
+	if _, err := regexp.Compile(*protectedVaultPattern); err != nil {
+		panic(fmt.Sprintf("invalid -protected-vault-pattern: %v", err))
+	}
+
+	if *defaultSAPolicy == "root" {
+		panic("invalid -default-sa-policy, the root policy cannot be attached")
+	}
+
+	if *policyPerSA && *groupByIdentity {
+		panic("-policy-per-sa and -group-by-identity cannot be combined")
+	}
+
+	aliasMetadataMapping, err = parseLabelMapping(*aliasMetadataLabels)
+	if err != nil {
+		panic(fmt.Sprintf("invalid -alias-metadata-labels: %v", err))
+	}
+	if len(aliasMetadataMapping) > 0 && !*writeMarkers && !*writeIndex {
+		panic("-alias-metadata-labels needs -write-markers or -write-index")
+	}
+
+	if *deleteLegacyRoles && !*migrateRolePaths {
+		panic("-delete-legacy-roles needs -migrate-role-paths")
+	}
+
+	if _, err := splitList(*accessCRDPolicies); err != nil {
+		panic(fmt.Sprintf("invalid -access-crd-policies: %v", err))
+	}
+
+	if _, err := parseNamespaceGroups(*namespaceGroups); err != nil {
+		panic(fmt.Sprintf("invalid -namespace-groups: %v", err))
+	}
+
+	if *ownerAPIVersion != "" && *ownerKind == "" {
+		panic("-owner-api-version needs -owner-kind")
+	}
+
+	names, err = selectNameStrategy(*nameStrategyName)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if err := checkPhase(*defaultPhase); err != nil {
+		panic(fmt.Sprintf("invalid -default-phase: %v", err))
+	}
+
+	if *explicitMaxTTL < 0 {
+		panic(fmt.Sprintf("invalid -token-explicit-max-ttl %s, should not be negative", *explicitMaxTTL))
+	}
+
+	if *kvVersion != 1 && *kvVersion != 2 {
+		panic(fmt.Sprintf("invalid -kv-version %d, should be 1 or 2", *kvVersion))
+	}
+
+	if _, ok := outputLayouts[*outputLayout]; !ok {
+		panic(fmt.Sprintf("invalid -output-layout %q, should be flat or by-namespace", *outputLayout))
+	}
+
+	if *reportFormat != "" && *reportFormat != "json" && *reportFormat != "csv" {
+		panic(fmt.Sprintf("invalid -report %q, should be json or csv", *reportFormat))
+	}
+
+	tierOverrides, err = loadTierOverrides(*tierOverridesFile)
+	if err != nil {
+		panic(fmt.Sprintf("invalid -tier-overrides: %v", err))
+	}
+
+	controlGroups, err = loadControlGroups(*controlGroupsFile)
+	if err != nil {
+		panic(fmt.Sprintf("invalid -control-groups: %v", err))
+	}
+
+	if *traceConfig {
+		printConfigTrace(os.Stdout)
+		return
+	}
+
+	if *validateOnly {
+		if err := validateTemplates(os.Stdout, sampleService()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// fail fast on an unusable Vault token, before any Kubernetes work
+	var client *Vault
+	if *reportFormat == "" && *inventoryMetrics == "" && *outputDir == "" {
+		fmt.Println("run", runID)
+
+		client, err = NewVaultClient(*vaultAddr, "")
+		if err != nil {
+			panic(err.Error())
+		}
+		client.useNamespace(*vaultNamespace)
+
+		// a diff only reads, whatever it would have written
+		client.ReadOnly = *diffMode
+
+		if !client.ReadOnly {
+			if err := checkProtectedAddr(client.client.Address()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if err := client.checkToken(*expectedRunDuration); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if len(controlGroups) > 0 {
+			if err := client.checkEnterprise(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if !*noAutodetectKV {
+			if err := client.detectKV(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			// tier deny entries depend on the detected version
+			tierOverrides, err = loadTierOverrides(*tierOverridesFile)
+			if err != nil {
+				panic(fmt.Sprintf("invalid -tier-overrides: %v", err))
+			}
+		}
+
+		if *sinceReport != "" && !*diffMode {
+			client.changes, err = loadChangeSet(*sinceReport)
+			if err != nil {
+				panic(fmt.Sprintf("invalid -since-report: %v", err))
+			}
+		}
 	}
-	flag.Parse()
 
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	// connection to the API server, the context also names the templates
+	config, context, err := loadKubeConfig(*kubeconfig, *kubeContext)
 	if err != nil {
 		panic(err.Error())
 	}
 
+	config.QPS = float32(*k8sQPS)
+	config.Burst = *k8sBurst
+
 	// create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	context, err := getCurrentContext()
+	var services = []Service{}
+	var managed []marker
+	summary := &runSummary{RunID: runID}
+
+	deployments, err := clientset.AppsV1().Deployments("").List(metav1.ListOptions{LabelSelector: *selector})
 	if err != nil {
 		panic(err.Error())
 	}
+	deployments.Items = ownedDeployments(deployments.Items)
 
-	// fmt.Println("Context: ", context)
-
-	var services = []Service{}
+	if *inventoryMetrics != "" {
+		if err := writeInventoryMetricsFile(*inventoryMetrics, deployments.Items); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
 
-	deployments, err := clientset.AppsV1().Deployments("").List(metav1.ListOptions{})
+	accounts := newServiceAccountCache(clientset)
+	phases := newNamespacePhases(clientset)
+	access := newAccessCache(clientset, context)
 
 	for _, v := range deployments.Items {
-		serviceAccount := v.Spec.Template.Spec.ServiceAccountName
-		if serviceAccount == "" {
-			serviceAccount = DefaultServiceAccountName
+		name := v.GetNamespace() + "/" + v.GetName()
+
+		service, err := newService(v, context, audiences)
+		if err != nil {
+			servicePrintf("%v", err)
+			summary.failed(name, err, 0)
+			continue
+		}
+
+		// policies for a namespace being torn down would only be churn
+		if !*includeTerminating && phases.terminating(service.Namespace) {
+			servicePrintf("%s: skipped, namespace is terminating", name)
+			summary.skipped(name, "namespace is terminating")
+			continue
+		}
+
+		// a role is useless to a workload which cannot present a token
+		if *checkAutomount {
+			account, err := accounts.get(service.Namespace, service.AccountName)
+			if err == nil && automountDisabled(v, account) {
+				err = errors.New("service account token automounting is disabled, the role will not be usable")
+			}
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				if *strict {
+					servicePrintf("%v", err)
+					summary.failed(name, err, 0)
+					continue
+				}
+				servicePrintf("warning: %v", err)
+			}
+		}
+
+		if *accessCRD {
+			service.Access, err = access.get(service.Namespace, service.AccountName)
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, 0)
+				continue
+			}
 		}
-		service := Service{
-			Name:        v.GetObjectMeta().GetName(),
-			Context:     context,
-			Namespace:   v.GetObjectMeta().GetNamespace(),
-			AccountName: serviceAccount,
+
+		if *groupByIdentity {
+			service.Identity, err = deploymentIdentity(v, service.AccountName, accounts)
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, 0)
+				continue
+			}
 		}
 
 		services = append(services, service)
+	}
 
-		// fmt.Println(services)
+	if *groupByIdentity {
+		var errs map[string]error
+		services, errs = groupServices(services)
+		for _, identity := range sortedErrorKeys(errs) {
+			servicePrintf("%v", errs[identity])
+			summary.failed("identity "+identity, errs[identity], 0)
+		}
 	}
 
-	client, err := NewVaultClient(vaultAddr, "")
-	if err != nil {
-		panic(err.Error())
+	if *policyPerSA {
+		var errs map[string]error
+		services, errs = groupByAccount(services)
+		for _, account := range sortedErrorKeys(errs) {
+			servicePrintf("%v", errs[account])
+			summary.failed("service account "+account, errs[account], 0)
+		}
+	}
+
+	// one role per service account binding
+	var messages []string
+	var errs map[string]error
+	services, messages, errs = mergeSharedAccounts(services)
+	for _, message := range messages {
+		servicePrintf("%s", message)
+	}
+	for _, name := range sortedErrorKeys(errs) {
+		servicePrintf("%v", errs[name])
+		summary.failed(name, errs[name], 0)
+	}
+
+	// services sharing a name would overwrite each other's policy or role
+	if err := checkNameCollisions(services); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *outputDir != "" {
+		errs, err := writeOutput(*outputDir, services, audiences)
+		if err != nil {
+			panic(err.Error())
+		}
+		for _, name := range sortedErrorKeys(errs) {
+			servicePrintf("%v", errs[name])
+			summary.failed(name, errs[name], 0)
+		}
+		fmt.Printf("rendered %d services into %s\n", len(services)-len(errs), *outputDir)
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *reportFormat != "" {
+		if err := writeReport(os.Stdout, *reportFormat, services); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
+
+	if *randomizeOrder {
+		seed := shuffleServices(services, *orderSeed)
+		fmt.Println("applying services in random order, -order-seed", seed)
 	}
+	mergedLast(services)
+
+	shared := newSharedPolicyWriter(client)
+	defaultRoles := newDefaultSARoleWriter(client, audiences)
+	// roles applied so far, merged services fail with the role they share
+	applied := map[string]bool{}
 
 	for _, service := range services {
+		name := service.Namespace + "/" + service.Name
+		started := time.Now()
+
+		if err := client.enterNamespace(service); err != nil {
+			err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+			servicePrintf("%v", err)
+			summary.failed(name, err, time.Since(started))
+			continue
+		}
+
+		if service.MergedRole != "" && !applied[client.objectKey("role", service.MergedRole)] {
+			err := fmt.Errorf("%s/%s: the role %s it was merged into failed", service.Namespace, service.Name, service.MergedRole)
+			servicePrintf("%v", err)
+			summary.failed(name, err, time.Since(started))
+			continue
+		}
+
+		if *defaultSAPolicy != "" && service.usesDefaultAccount() && *diffMode {
+			servicePrintf("%s: uses the shared default service account role, not compared", name)
+			summary.skipped(name, "uses the shared default service account role")
+			continue
+		}
+
+		if *diffMode {
+			differences, err := client.diffService(service)
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, time.Since(started))
+				continue
+			}
+			if service.MergedRole == "" {
+				applied[client.objectKey("role", service.rolePath())] = true
+			}
+			if len(differences) == 0 {
+				servicePrintf("%s: unchanged", name)
+			}
+			for _, difference := range differences {
+				servicePrintf("%s: %s", name, difference)
+			}
+			if *migrateRolePaths {
+				role := service.MergedRole
+				if role == "" {
+					role = service.rolePath()
+				}
+				migration, err := client.migrateRole(service, role)
+				if err != nil {
+					servicePrintf("%s: %v", name, err)
+				} else if migration != "" {
+					servicePrintf("%s: %s", name, migration)
+				}
+			}
+			summary.succeeded(name, time.Since(started))
+			continue
+		}
+
+		// the role must not reference a shared policy which does not exist
+		if *sharedNamespacePolicy {
+			if err := shared.ensure(service); err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, time.Since(started))
+				continue
+			}
+		}
+
+		// default service account workloads share their namespace's role
+		if *defaultSAPolicy != "" && service.usesDefaultAccount() {
+			role, err := defaultRoles.ensure(service)
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, time.Since(started))
+				continue
+			}
+			servicePrintf("%s", role)
+			summary.succeeded(name, time.Since(started))
+			continue
+		}
+
 		policy, err := client.addPolicy(service)
 		if err != nil {
-			fmt.Println(err)
+			err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+			servicePrintf("%v", err)
+			summary.failed(name, err, time.Since(started))
+			continue
+		}
+
+		role := service.MergedRole
+		if role == "" {
+			role, err = client.writeRole(policy, service)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+			servicePrintf("%v", err)
+			summary.failed(name, err, time.Since(started))
+			continue
+		}
+		applied[client.objectKey("role", role)] = true
+
+		// the new role is in place, live logins can move over
+		if *migrateRolePaths {
+			migration, err := client.migrateRole(service, role)
+			if err != nil {
+				err = fmt.Errorf("%s/%s: %v", service.Namespace, service.Name, err)
+				servicePrintf("%v", err)
+				summary.failed(name, err, time.Since(started))
+				continue
+			}
+			if migration != "" {
+				servicePrintf("%s: %s", name, migration)
+			}
+		}
+
+		m := newMarker(service, policy, role)
+		managed = append(managed, m)
+
+		// the policy and role are what matters, a missing marker only
+		// loses the record of where they came from
+		if *writeMarkers {
+			if err := client.writeServiceMarker(service, m); err != nil {
+				servicePrintf("%v", err)
+				summary.failed(name, err, time.Since(started))
+				continue
+			}
+		}
+
+		servicePrintf("%s", role)
+		summary.succeeded(name, time.Since(started))
+	}
+
+	// run-wide entries belong to the global namespace
+	client.useNamespace(*vaultNamespace)
+
+	if *writeIndex && !*diffMode {
+		// a scoped run only replaces the index entries of workloads in scope
+		var keep func(map[string]interface{}) bool
+		if *scopeToSelector {
+			inScope := map[string]bool{}
+			for _, service := range services {
+				inScope[service.Namespace+"/"+service.Name] = true
+			}
+			keep = func(entry map[string]interface{}) bool {
+				return !inScope[fmt.Sprintf("%v/%v", entry["namespace"], entry["name"])]
+			}
+		}
+
+		if err := client.writeIndex(managed, keep); err != nil {
+			fmt.Println("writing index:", err)
+		}
+	}
+
+	if client.changes != nil {
+		fmt.Printf("%d objects unchanged since %s\n", client.changes.unchanged, *sinceReport)
+		if err := client.changes.save(*sinceReport); err != nil {
+			fmt.Println("writing -since-report:", err)
+		}
+	}
+
+	fmt.Println(summary)
+
+	if *printUsedCapabilities {
+		fmt.Print(renderPolicy(client.used.stanzas()))
+	}
+
+	if *junitReport != "" {
+		if err := writeJUnitReport(*junitReport, summary); err != nil {
+			fmt.Println("writing JUnit report:", err)
 		}
+	}
+
+	if *emitEvents {
+		if err := recordSummaryEvent(clientset, eventRef, summary); err != nil {
+			fmt.Println("emitting summary event:", err)
+		}
+	}
+}
+
+// newService returns the Service for deployment, applying its annotation overrides
+func newService(deployment appsv1.Deployment, context string, audiences []string) (Service, error) {
+	meta := deployment.GetObjectMeta()
+	annotations := meta.GetAnnotations()
+
+	serviceAccount := deployment.Spec.Template.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = DefaultServiceAccountName
+	}
 
-		role, err := client.writeRole(policy, service)
+	if value, ok := annotations[BoundAudiencesAnnotation]; ok {
+		var err error
+		audiences, err = splitAudiences(value)
 		if err != nil {
-			fmt.Println(err)
+			return Service{}, fmt.Errorf("%s/%s: invalid %s annotation: %v", meta.GetNamespace(), meta.GetName(), BoundAudiencesAnnotation, err)
 		}
+	}
+
+	labels, err := templateLabels(meta.GetLabels())
+	if err != nil {
+		return Service{}, fmt.Errorf("%s/%s: %v", meta.GetNamespace(), meta.GetName(), err)
+	}
 
-		fmt.Println(role)
+	namespaces := boundNamespaces(meta.GetNamespace(), annotations)
+	if err := checkNamespaceGroup(namespaces); err != nil {
+		return Service{}, fmt.Errorf("%s/%s: invalid %s annotation: %v", meta.GetNamespace(), meta.GetName(), BoundNamespacesAnnotation, err)
 	}
 
+	phase := annotations[PhaseAnnotation]
+	if phase != "" {
+		if err := checkPhase(phase); err != nil {
+			return Service{}, fmt.Errorf("%s/%s: invalid %s annotation: %v", meta.GetNamespace(), meta.GetName(), PhaseAnnotation, err)
+		}
+	}
+
+	return Service{
+		Name:        meta.GetName(),
+		Context:     context,
+		Namespace:   meta.GetNamespace(),
+		AccountName: serviceAccount,
+		Namespaces:  namespaces,
+		Audiences:   audiences,
+		Tier:        annotations[TierAnnotation],
+		Phase:       phase,
+		Labels:      labels,
+	}, nil
 }
 
 func getVaultClient(vaultAddr, vaultToken string) (*api.Client, error) {
+	httpClient, err := vaultHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &api.Config{
-		Address: vaultAddr,
+		Address:    vaultAddr,
+		HttpClient: httpClient,
 	}
 
 	// creating a client
@@ -134,56 +706,156 @@ func NewVaultClient(vaultAddr, vaultToken string) (*Vault, error) {
 	}
 
 	return &Vault{
-		Client: client,
+		client:     client,
+		namespaces: map[string]error{},
+		used:       usedCapabilities{},
 	}, nil
 }
 
-func (vault *Vault) writeRole(policy string, service Service) (string, error) {
-	if policy == "default" || policy == "" {
-		return "", errors.New("policy should be defined and should be different than default")
+// write writes data to path, every logical write goes through here so the
+// read-only guard cannot be bypassed
+func (vault *Vault) write(path string, data map[string]interface{}) error {
+	if vault.ReadOnly {
+		return fmt.Errorf("%v: write to %s", ErrReadOnly, path)
 	}
 
-	policies := []string{"default"}
-	// pathTmpl := "auth/{{.Context}}/role/{{.Namespace}}-{{.Name}}-role"
+	// a write creates or updates, which one is not known beforehand
+	vault.use(path, "create", "update")
+	_, err := vault.client.Logical().Write(path, data)
+	return err
+}
+
+// delete deletes path, honouring the read-only guard
+func (vault *Vault) delete(path string) error {
+	if vault.ReadOnly {
+		return fmt.Errorf("%v: delete %s", ErrReadOnly, path)
+	}
 
-	pathTmpl := "auth/kubernetes/role/{{.Context}}{{.Namespace}}-{{.Name}}-role"
-	path := service.parseTemplate(pathTmpl)
+	vault.use(path, "delete")
+	_, err := vault.client.Logical().Delete(path)
+	return err
+}
 
-	data := map[string]interface{}{
-		"bound_service_account_names":      service.AccountName,
-		"bound_service_account_namespaces": service.Namespace,
-		"policies":                         append(policies, policy),
-		"ttl":                              "15m",
+// putPolicy writes the policy name, honouring the read-only guard
+func (vault *Vault) putPolicy(name, rule string) error {
+	if vault.ReadOnly {
+		return fmt.Errorf("%v: policy %s", ErrReadOnly, name)
+	}
+
+	vault.use("sys/policy/"+name, "create", "update")
+	return vault.client.Sys().PutPolicy(name, rule)
+}
+
+func (vault *Vault) writeRole(policy string, service Service) (string, error) {
+	data, err := service.roleData(policy)
+	if err != nil {
+		return "", err
+	}
+
+	path := service.rolePath()
+	if vault.changes.skip(vault.objectKey("role", path), data) {
+		return path, nil
 	}
 
-	_, err := vault.Client.Logical().Write(path, data)
+	err = vault.write(path, data)
 
 	if err != nil {
 		return "", err
 	}
 
+	if *verifyWrites {
+		if err := vault.verifyRole(path, data); err != nil {
+			return "", err
+		}
+	}
+
+	vault.changes.applied(vault.objectKey("role", path), data)
 	return path, nil
 }
 
-func (vault *Vault) addPolicy(service Service) (string, error) {
+// boundAccountNames returns the service accounts the role is bound to
+func (service *Service) boundAccountNames() []string {
+	if len(service.AccountNames) > 0 {
+		return service.AccountNames
+	}
+	return []string{service.AccountName}
+}
+
+// rolePolicies returns every policy attached to the service's role
+func (service *Service) rolePolicies(policy string) []string {
+	policies := append([]string{"default", policy}, service.sharedPolicyNames()...)
+	policies = append(policies, service.MergedPolicies...)
+	if *noDefaultPolicy {
+		policies = policies[1:]
+	}
+	if service.Access != nil {
+		policies = append(policies, service.Access.Policies...)
+	}
+	return policies
+}
+
+// roleData returns the fields of the service's role granting policy
+func (service *Service) roleData(policy string) (map[string]interface{}, error) {
+	if policy == "default" || policy == "" {
+		return nil, errors.New("policy should be defined and should be different than default")
+	}
+
+	data := map[string]interface{}{
+		"bound_service_account_names":      service.boundAccountNames(),
+		"bound_service_account_namespaces": service.Namespaces,
+		"policies":                         service.rolePolicies(policy),
+		"ttl":                              "15m",
+	}
+	if service.Access != nil && service.Access.TTL != "" {
+		data["ttl"] = service.Access.TTL
+	}
+	if *explicitMaxTTL > 0 {
+		data["token_explicit_max_ttl"] = int(explicitMaxTTL.Seconds())
+	}
+	if *noDefaultPolicy {
+		data["token_no_default_policy"] = true
+	}
+
+	// kubernetes auth roles bind a single audience, the field is only
+	// written when one was requested
+	if len(service.Audiences) > 1 {
+		return nil, fmt.Errorf("kubernetes auth roles accept a single audience, got %v", service.Audiences)
+	}
+	if len(service.Audiences) == 1 {
+		data["audience"] = service.Audiences[0]
+	}
 
-	policyNameTmpl := "{{.Context}}-{{.Namespace}}-{{.Name}}"
-	policyRuleTmpl := `path "secret/data/{{.Context}}/{{.Namespace}}/{{.Name}}/*" {
-		capabilities = ["create", "read", "update", "delete", "list"]
-	  }`
+	return data, nil
+}
+
+func (vault *Vault) addPolicy(service Service) (string, error) {
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		return "", err
+	}
 
-	policyName := service.parseTemplate(policyNameTmpl)
-	policyRule := service.parseTemplate(policyRuleTmpl)
+	policyName := service.policyName()
+	policyRule := renderPolicy(stanzas)
 
 	if policyName == "" || policyRule == "" {
 		return "", errors.New("something wrong with parsing templates")
 	}
-	sys := vault.Client.Sys()
-	err := sys.PutPolicy(policyName, policyRule)
+	if vault.changes.skip(vault.objectKey("policy", policyName), policyRule) {
+		return policyName, nil
+	}
+
+	err = vault.putPolicy(policyName, policyRule)
 	if err != nil {
 		return "", err
 	}
 
+	if *verifyWrites {
+		if err := vault.verifyPolicy(policyName, policyRule); err != nil {
+			return "", err
+		}
+	}
+
+	vault.changes.applied(vault.objectKey("policy", policyName), policyRule)
 	return policyName, nil
 }
 
@@ -191,7 +863,7 @@ func (service *Service) parseTemplate(t string) string {
 	// define a buffer writer
 	var writer bytes.Buffer
 
-	tmpl, err := template.New("template").Parse(t)
+	tmpl, err := template.New("template").Funcs(templateFuncs()).Parse(t)
 	if err != nil {
 		return ""
 	}
@@ -201,24 +873,99 @@ func (service *Service) parseTemplate(t string) string {
 		return ""
 	}
 
-	
 	return writer.String()
 }
 
-func homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
+// splitAudiences splits a comma-separated audience list, kubernetes auth
+// roles bind at most one audience
+func splitAudiences(value string) ([]string, error) {
+	audiences, err := splitList(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(audiences) > 1 {
+		return nil, fmt.Errorf("kubernetes auth roles accept a single audience, got %v", audiences)
+	}
+	return audiences, nil
+}
+
+// splitList splits a comma-separated list, rejecting empty entries
+func splitList(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("empty entry in %q", value)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// contains reports whether items holds item
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFuncs functions available to every template
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"kvVersion": func() int { return *kvVersion },
+		"sep":       func() string { return *nameSeparator },
+	}
+}
+
+// boundNamespaces returns the sorted namespaces a role is bound to: the
+// deployment's own namespace plus any listed in BoundNamespacesAnnotation
+func boundNamespaces(namespace string, annotations map[string]string) []string {
+	seen := map[string]bool{namespace: true}
+	namespaces := []string{namespace}
+
+	for _, ns := range strings.Split(annotations[BoundNamespacesAnnotation], ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
 	}
-	return os.Getenv("USERPROFILE") // windows
+
+	sort.Strings(namespaces)
+	return namespaces
 }
 
-func getCurrentContext() (string, error) {
-	pathOptions := clientcmd.NewDefaultPathOptions()
+// loadKubeConfig resolves the kubeconfig the same way kubectl does, from
+// kubeconfig, $KUBECONFIG or ~/.kube/config, and returns the client config
+// together with the name of the context it was built from
+func loadKubeConfig(kubeconfig, context string) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
 
-	config, err := pathOptions.GetStartingConfig()
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
-		return "", err
+		return nil, "", err
+	}
+
+	if context == "" {
+		raw, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, "", err
+		}
+		context = raw.CurrentContext
 	}
 
-	return config.CurrentContext, nil
+	return config, context, nil
 }
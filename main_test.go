@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setFlag sets the flag name to value for a test, returning the function
+// restoring its previous value
+func setFlag(t *testing.T, name, value string) func() {
+	f := flag.Lookup(name)
+	if f == nil {
+		t.Fatalf("no flag %s", name)
+	}
+
+	previous := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatalf("setting -%s %q: %v", name, value, err)
+	}
+	return func() {
+		f.Value.Set(previous)
+	}
+}
+
+// testService returns a service named name in namespace of context prod
+func testService(namespace, name string) Service {
+	return Service{
+		Name:        name,
+		Context:     "prod",
+		Namespace:   namespace,
+		AccountName: name,
+		Namespaces:  []string{namespace},
+	}
+}
+
+// annotatedDeployment returns the deployment name in namespace with annotations
+func annotatedDeployment(namespace, name string, annotations map[string]string) appsv1.Deployment {
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Annotations: annotations},
+	}
+}
+
+func TestNewServiceAudiences(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		audiences   []string
+		want        []string
+		err         bool
+	}{
+		{"none", nil, nil, nil, false},
+		{"flag", nil, []string{"vault"}, []string{"vault"}, false},
+		{"annotation", map[string]string{BoundAudiencesAnnotation: "api"}, []string{"vault"}, []string{"api"}, false},
+		{"several in annotation", map[string]string{BoundAudiencesAnnotation: "vault,api"}, nil, nil, true},
+		{"empty entry in annotation", map[string]string{BoundAudiencesAnnotation: "vault,"}, nil, nil, true},
+	}
+
+	for _, test := range tests {
+		service, err := newService(annotatedDeployment("shop", "api", test.annotations), "prod", test.audiences)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got audiences %v, want an error", test.name, service.Audiences)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(service.Audiences, test.want) {
+			t.Errorf("%s: audiences = %v, want %v", test.name, service.Audiences, test.want)
+		}
+	}
+}
+
+func TestSplitAudiences(t *testing.T) {
+	if audiences, err := splitAudiences("vault"); err != nil || !reflect.DeepEqual(audiences, []string{"vault"}) {
+		t.Errorf("splitAudiences(vault) = %v, %v", audiences, err)
+	}
+	if audiences, err := splitAudiences(""); err != nil || audiences != nil {
+		t.Errorf("splitAudiences() = %v, %v", audiences, err)
+	}
+	if _, err := splitAudiences("vault,api"); err == nil {
+		t.Error("splitAudiences(vault,api) accepted two audiences")
+	}
+}
+
+// roleServer returns a Vault server recording the fields of the last role
+// written into role
+func roleServer(t *testing.T, role *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*role = nil
+		if err := json.NewDecoder(r.Body).Decode(role); err != nil {
+			t.Errorf("decoding %s %s: %v", r.Method, r.URL.Path, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestWriteRoleAudience(t *testing.T) {
+	var role map[string]interface{}
+	server := roleServer(t, &role)
+	defer server.Close()
+
+	vault, err := NewVaultClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := testService("shop", "api")
+	if _, err := vault.writeRole("prod-shop-api", service); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := role["audience"]; ok {
+		t.Errorf("audience = %v without bound audiences, want none", role["audience"])
+	}
+
+	service.Audiences = []string{"vault"}
+	if _, err := vault.writeRole("prod-shop-api", service); err != nil {
+		t.Fatal(err)
+	}
+	if role["audience"] != "vault" {
+		t.Errorf("audience = %v, want vault", role["audience"])
+	}
+}
+
+// twoContextsKubeconfig kubeconfig with the current context dev and prod
+const twoContextsKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+`
+
+func TestLoadKubeConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(twoContextsKubeconfig); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	tests := []struct {
+		context string
+		want    string
+		host    string
+	}{
+		{"", "dev", "https://dev.example.com:6443"},
+		{"prod", "prod", "https://prod.example.com:6443"},
+	}
+
+	for _, test := range tests {
+		config, context, err := loadKubeConfig(file.Name(), test.context)
+		if err != nil {
+			t.Errorf("-context %q: %v", test.context, err)
+			continue
+		}
+		if context != test.want || config.Host != test.host {
+			t.Errorf("-context %q: got context %s on %s, want %s on %s", test.context, context, config.Host, test.want, test.host)
+		}
+	}
+
+	if _, _, err := loadKubeConfig(file.Name(), "staging"); err == nil {
+		t.Error("unknown context staging accepted")
+	}
+}
+
+func TestRoleDataTokenSettings(t *testing.T) {
+	service := testService("shop", "api")
+
+	data, err := service.roleData("prod-shop-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"token_explicit_max_ttl", "token_no_default_policy"} {
+		if _, ok := data[field]; ok {
+			t.Errorf("%s = %v by default, want it unset", field, data[field])
+		}
+	}
+
+	defer setFlag(t, "token-explicit-max-ttl", "24h")()
+	defer setFlag(t, "no-default-policy", "true")()
+
+	data, err = service.roleData("prod-shop-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["token_explicit_max_ttl"] != 86400 {
+		t.Errorf("token_explicit_max_ttl = %#v, want 86400 seconds", data["token_explicit_max_ttl"])
+	}
+	if data["token_no_default_policy"] != true {
+		t.Errorf("token_no_default_policy = %#v, want true", data["token_no_default_policy"])
+	}
+	if policies := service.rolePolicies("prod-shop-api"); !reflect.DeepEqual(policies, []string{"prod-shop-api"}) {
+		t.Errorf("policies = %v, want default left out", policies)
+	}
+}
+
+func TestReadOnlyVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("read-only client sent %s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+
+	vault, err := NewVaultClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.ReadOnly = true
+
+	if err := vault.write("auth/kubernetes/role/prod-shop-api-role", map[string]interface{}{}); err == nil {
+		t.Error("write succeeded")
+	}
+	if err := vault.delete("auth/kubernetes/role/prod-shop-api-role"); err == nil {
+		t.Error("delete succeeded")
+	}
+	if err := vault.putPolicy("prod-shop-api", ""); err == nil {
+		t.Error("putPolicy succeeded")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	writeMarkers   = flag.Bool("write-markers", false, "write a KV marker recording the source of every managed policy and role")
+	markerPath     = flag.String("marker-path", "_markers", "path below -kv-mount markers are written to")
+	requireMarkers = flag.Bool("require-markers", false, "fail a service whose marker cannot be written instead of warning")
+)
+
+// marker KV entry recording which workload a managed policy and role belong to
+type marker struct {
+	RunID          string
+	Context        string
+	Namespace      string
+	Name           string
+	ServiceAccount string
+	Policy         string
+	Role           string
+	// Identity shared identity the marker's service stands for, if any
+	Identity string
+	// AliasMetadata identity metadata taken from the workload's labels
+	AliasMetadata map[string]string
+}
+
+// data returns the marker as KV fields
+func (m marker) data() map[string]interface{} {
+	data := map[string]interface{}{
+		"run_id":          m.RunID,
+		"context":         m.Context,
+		"namespace":       m.Namespace,
+		"name":            m.Name,
+		"service_account": m.ServiceAccount,
+		"policy":          m.Policy,
+		"role":            m.Role,
+	}
+	if m.Identity != "" {
+		data["identity"] = m.Identity
+	}
+	if len(m.AliasMetadata) > 0 {
+		data["alias_metadata"] = m.AliasMetadata
+	}
+	return data
+}
+
+// path returns the KV subtree of the marker, one per service as services may
+// share a policy or role. An identity is named after no single namespace, the
+// underscore cannot clash with one.
+func (m marker) path() string {
+	if m.Identity != "" {
+		return strings.Trim(*markerPath, "/") + "/" + m.Context + "/_identity/" + m.Identity
+	}
+	return strings.Trim(*markerPath, "/") + "/" + m.Context + "/" + m.Namespace + "/" + m.Name
+}
+
+// newMarker returns the marker of the service's policy and role
+func newMarker(service Service, policy, role string) marker {
+	return marker{
+		RunID:          runID,
+		Context:        service.Context,
+		Namespace:      service.Namespace,
+		Name:           service.Name,
+		ServiceAccount: service.AccountName,
+		Policy:         policy,
+		Role:           role,
+		Identity:       service.Identity,
+		AliasMetadata:  service.aliasMetadata(),
+	}
+}
+
+// writeMarker writes m below -marker-path
+func (vault *Vault) writeMarker(m marker) error {
+	return vault.writeKV(m.path(), m.data())
+}
+
+// writeServiceMarker writes the marker m of service, a marker which cannot
+// be written is only warned about unless -require-markers
+func (vault *Vault) writeServiceMarker(service Service, m marker) error {
+	if err := vault.writeMarker(m); err != nil {
+		err = fmt.Errorf("%s/%s: writing marker: %v", service.Namespace, service.Name, err)
+		if *requireMarkers {
+			return err
+		}
+		servicePrintf("warning: %v", err)
+	}
+	return nil
+}
+
+// writeKV writes data to subtree of the KV mount, wrapping it as KV version 2 expects
+func (vault *Vault) writeKV(subtree string, data map[string]interface{}) error {
+	if *kvVersion != 1 {
+		data = map[string]interface{}{"data": data}
+	}
+
+	return vault.write(kvPath("data", subtree), data)
+}
+
+// readKV reads subtree of the KV mount, unwrapping KV version 2 responses,
+// a missing entry returns no data
+func (vault *Vault) readKV(subtree string) (map[string]interface{}, error) {
+	vault.use(kvPath("data", subtree), "read")
+	secret, err := vault.client.Logical().Read(kvPath("data", subtree))
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	if *kvVersion == 1 {
+		return secret.Data, nil
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+	return data, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// markerServer returns a Vault server answering every request with status,
+// counting the requests in requests
+func markerServer(status int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status >= 400 {
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+		}
+	}))
+}
+
+func TestWriteServiceMarker(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		required string
+		fail     bool
+	}{
+		{"written", http.StatusNoContent, "false", false},
+		{"written and required", http.StatusNoContent, "true", false},
+		{"best-effort", http.StatusForbidden, "false", false},
+		{"required", http.StatusForbidden, "true", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setFlag(t, "require-markers", test.required)()
+
+			var requests int
+			server := markerServer(test.status, &requests)
+			defer server.Close()
+
+			vault, err := NewVaultClient(server.URL, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			service := testService("shop", "api")
+			err = vault.writeServiceMarker(service, newMarker(service, "prod-shop-api", "auth/kubernetes/role/prod-shop-api-role"))
+			if (err != nil) != test.fail {
+				t.Errorf("error = %v, want failure %v", err, test.fail)
+			}
+			if requests != 1 {
+				t.Errorf("sent %d requests, want the marker write", requests)
+			}
+		})
+	}
+}
+
+func TestMarkerData(t *testing.T) {
+	service := testService("shop", "api")
+	data := newMarker(service, "prod-shop-api", "auth/kubernetes/role/prod-shop-api-role").data()
+
+	for key, want := range map[string]string{
+		"context":         "prod",
+		"namespace":       "shop",
+		"name":            "api",
+		"service_account": "api",
+		"policy":          "prod-shop-api",
+		"role":            "auth/kubernetes/role/prod-shop-api-role",
+	} {
+		if data[key] != want {
+			t.Errorf("%s = %v, want %s", key, data[key], want)
+		}
+	}
+	if _, ok := data["alias_metadata"]; ok {
+		t.Error("alias_metadata written without -alias-metadata-labels")
+	}
+}
+
+func TestMarkerPath(t *testing.T) {
+	api := testService("shop", "api")
+	worker := testService("shop", "worker")
+	// merged services share the role, identities the policy
+	worker.MergedRole = api.rolePath()
+	payments := testService("shop", "api")
+	payments.Name = "payments"
+	payments.Identity = "payments"
+
+	tests := []struct {
+		service Service
+		want    string
+	}{
+		{api, "_markers/prod/shop/api"},
+		{worker, "_markers/prod/shop/worker"},
+		{payments, "_markers/prod/_identity/payments"},
+	}
+
+	for _, test := range tests {
+		m := newMarker(test.service, "prod-shop-api", api.rolePath())
+		if path := m.path(); path != test.want {
+			t.Errorf("%s/%s: path = %q, want %q", test.service.Namespace, test.service.Name, path, test.want)
+		}
+	}
+
+	defer setFlag(t, "marker-path", "/audit/markers/")()
+	if path := newMarker(api, "prod-shop-api", api.rolePath()).path(); path != "audit/markers/prod/shop/api" {
+		t.Errorf("path = %q, want audit/markers/prod/shop/api", path)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// mergeSharedAccounts merges services whose roles would bind exactly the
+// same service accounts in the same namespaces into the role of the first of
+// them, which lists the policies of all. Services whose bindings only
+// overlap, or cannot share a role, are reported. Under -strict every
+// duplicate binding fails the services involved instead.
+func mergeSharedAccounts(services []Service) ([]Service, []string, map[string]error) {
+	var messages []string
+	errs := map[string]error{}
+	failed := map[int]bool{}
+
+	// services by binding, and the bindings of each service account in a namespace
+	bindings := map[string][]int{}
+	pairs := map[string]map[string]bool{}
+	for i := range services {
+		service := &services[i]
+		// the default service account role is shared by design
+		if *defaultSAPolicy != "" && service.usesDefaultAccount() {
+			continue
+		}
+
+		accounts := append([]string(nil), service.boundAccountNames()...)
+		namespaces := append([]string(nil), service.Namespaces...)
+		sort.Strings(accounts)
+		sort.Strings(namespaces)
+		binding := strings.Join(accounts, ",") + " in " + strings.Join(namespaces, ",")
+		bindings[binding] = append(bindings[binding], i)
+
+		for _, namespace := range namespaces {
+			for _, account := range accounts {
+				pair := namespace + "/" + account
+				if pairs[pair] == nil {
+					pairs[pair] = map[string]bool{}
+				}
+				pairs[pair][binding] = true
+			}
+		}
+	}
+
+	// overlapping but different bindings cannot be merged into one role
+	for _, pair := range sortedSetKeys(pairs) {
+		if len(pairs[pair]) < 2 {
+			continue
+		}
+		var names []string
+		for binding := range pairs[pair] {
+			for _, i := range bindings[binding] {
+				names = append(names, services[i].Namespace+"/"+services[i].Name)
+				if *strict {
+					failed[i] = true
+					errs[services[i].Namespace+"/"+services[i].Name] = fmt.Errorf("%s/%s: service account binding %s is shared with other roles", services[i].Namespace, services[i].Name, pair)
+				}
+			}
+		}
+		sort.Strings(names)
+		if *strict {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("warning: service account %s is bound by the roles of %s with different bindings, not merged", pair, strings.Join(names, ", ")))
+	}
+
+	for _, binding := range sortedIndexKeys(bindings) {
+		members := bindings[binding]
+		if len(members) < 2 {
+			continue
+		}
+		sort.Slice(members, func(a, b int) bool {
+			return services[members[a]].Namespace+"/"+services[members[a]].Name < services[members[b]].Namespace+"/"+services[members[b]].Name
+		})
+
+		primary := &services[members[0]]
+		primaryName := primary.Namespace + "/" + primary.Name
+		if *strict {
+			for _, i := range members {
+				name := services[i].Namespace + "/" + services[i].Name
+				failed[i] = true
+				errs[name] = fmt.Errorf("%s: service account binding %s is shared with other roles", name, binding)
+			}
+			continue
+		}
+
+		for _, i := range members[1:] {
+			member := &services[i]
+			name := member.Namespace + "/" + member.Name
+
+			switch {
+			case failed[i] || failed[members[0]]:
+				continue
+			case member.policyName() == "":
+				continue
+			case strings.Join(member.Audiences, ",") != strings.Join(primary.Audiences, ",") || !reflect.DeepEqual(member.Access, primary.Access):
+				messages = append(messages, fmt.Sprintf("warning: %s binds %s like the role of %s but differs in audiences or VaultAccess, not merged", name, binding, primaryName))
+				continue
+			}
+
+			policy := member.policyName()
+			member.MergedRole = primary.rolePath()
+			primary.MergedPolicies = append(primary.MergedPolicies, policy)
+			messages = append(messages, fmt.Sprintf("%s: policy %s merged into role %s of %s, its own role %s is no longer updated", name, policy, member.MergedRole, primaryName, member.rolePath()))
+		}
+	}
+
+	var kept []Service
+	for i, service := range services {
+		if !failed[i] {
+			kept = append(kept, service)
+		}
+	}
+	return kept, messages, errs
+}
+
+// mergedLast moves merged services behind all others, keeping the order
+// otherwise, so every shared role is applied before the services merged
+// into it
+func mergedLast(services []Service) {
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].MergedRole == "" && services[j].MergedRole != ""
+	})
+}
+
+// sortedSetKeys returns the keys of sets in order
+func sortedSetKeys(sets map[string]map[string]bool) []string {
+	keys := make([]string, 0, len(sets))
+	for key := range sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedIndexKeys returns the keys of indexes in order
+func sortedIndexKeys(indexes map[string][]int) []string {
+	keys := make([]string, 0, len(indexes))
+	for key := range indexes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
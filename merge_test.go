@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sharedAccountServices returns api and worker running as the service
+// account app in shop
+func sharedAccountServices() []Service {
+	api := testService("shop", "api")
+	api.AccountName = "app"
+	worker := testService("shop", "worker")
+	worker.AccountName = "app"
+	return []Service{worker, api}
+}
+
+func TestMergeSharedAccounts(t *testing.T) {
+	services, messages, errs := mergeSharedAccounts(sharedAccountServices())
+	if len(errs) != 0 || len(services) != 2 {
+		t.Fatalf("got %d services and errors %v, want 2 services", len(services), errs)
+	}
+
+	worker, api := services[0], services[1]
+	if worker.MergedRole != "auth/kubernetes/role/prod-shop-api-role" {
+		t.Errorf("worker merged into %q, want the role of api", worker.MergedRole)
+	}
+	if api.MergedRole != "" {
+		t.Errorf("api merged into %q, want its own role", api.MergedRole)
+	}
+	if want := []string{"default", "prod-shop-api", "prod-shop-worker"}; !reflect.DeepEqual(api.rolePolicies(api.policyName()), want) {
+		t.Errorf("api role policies = %v, want %v", api.rolePolicies(api.policyName()), want)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "prod-shop-worker-role is no longer updated") {
+		t.Errorf("messages = %q, want the merge of worker", messages)
+	}
+}
+
+func TestMergeSharedAccountsOverlap(t *testing.T) {
+	services := sharedAccountServices()
+	services[0].Namespaces = []string{"shop", "ops"}
+
+	services, messages, errs := mergeSharedAccounts(services)
+	if len(errs) != 0 || len(services) != 2 {
+		t.Fatalf("got %d services and errors %v, want 2 services", len(services), errs)
+	}
+	for _, service := range services {
+		if service.MergedRole != "" || len(service.MergedPolicies) != 0 {
+			t.Errorf("%s merged, want overlapping bindings kept apart", service.Name)
+		}
+	}
+	if len(messages) != 1 || !strings.HasPrefix(messages[0], "warning: service account shop/app") {
+		t.Errorf("messages = %q, want an overlap warning", messages)
+	}
+}
+
+func TestMergeSharedAccountsStrict(t *testing.T) {
+	defer setFlag(t, "strict", "true")()
+
+	services, messages, errs := mergeSharedAccounts(sharedAccountServices())
+	if len(services) != 0 || len(messages) != 0 {
+		t.Errorf("got services %v and messages %q, want both failed", services, messages)
+	}
+	for _, name := range []string{"shop/api", "shop/worker"} {
+		if errs[name] == nil {
+			t.Errorf("%s did not fail", name)
+		}
+	}
+}
+
+func TestWriteReportMerged(t *testing.T) {
+	services, _, _ := mergeSharedAccounts(sharedAccountServices())
+
+	var buf strings.Builder
+	if err := writeReport(&buf, "csv", services); err != nil {
+		t.Fatal(err)
+	}
+	want := "prod-shop-worker,default;prod-shop-api;prod-shop-worker"
+	if !strings.Contains(buf.String(), "auth/kubernetes/role/prod-shop-api-role,"+want) {
+		t.Errorf("report\n%s\nlacks worker with the role and policies of api", buf.String())
+	}
+}
+
+func TestMergedLast(t *testing.T) {
+	services, _, _ := mergeSharedAccounts(append(sharedAccountServices(), testService("ops", "web")))
+	if services[0].Name != "worker" {
+		t.Fatalf("services = %+v, want worker merged before api", services)
+	}
+
+	mergedLast(services)
+	var order []string
+	for _, service := range services {
+		order = append(order, service.Name)
+	}
+	if want := []string{"api", "web", "worker"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
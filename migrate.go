@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	migrateRolePaths  = flag.Bool("migrate-role-paths", false, "report services whose role still exists under the legacy concatenated name, next to the role written")
+	deleteLegacyRoles = flag.Bool("delete-legacy-roles", false, "with -migrate-role-paths delete the legacy role once the new one is written")
+)
+
+// legacyRolePath returns the path the service's role had before names were
+// separated consistently, empty when it had none or it is the current one
+func legacyRolePath(service Service, role string) string {
+	// grouped identities and service accounts did not exist back then
+	if service.Identity != "" || len(service.Deployments) > 0 {
+		return ""
+	}
+
+	name := legacyNames{}.RoleName(service)
+	if name == "" || roleAuthPath+name == role {
+		return ""
+	}
+	return roleAuthPath + name
+}
+
+// readLegacyRole returns the fields of the role at the legacy path, nil when
+// there is none
+func (vault *Vault) readLegacyRole(path string) (map[string]interface{}, error) {
+	vault.use(path, "read")
+	secret, err := vault.client.Logical().Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading legacy role %s: %v", path, err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	if secret.Data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return secret.Data, nil
+}
+
+// legacyRoleMismatches returns how the stored legacy role differs from the
+// bindings and policies of the service's own role, a legacy name may have
+// been rendered for another workload as well
+func legacyRoleMismatches(service Service, stored map[string]interface{}) ([]string, error) {
+	data, err := service.roleData(service.policyName())
+	if err != nil {
+		return nil, err
+	}
+
+	want := map[string]interface{}{}
+	for _, field := range []string{"bound_service_account_names", "bound_service_account_namespaces", "policies"} {
+		want[field] = data[field]
+	}
+	return roleMismatches(stored, want), nil
+}
+
+// migrateRole reports the service's legacy role, now superseded by role,
+// deleting it with -delete-legacy-roles, or previews that in read-only mode
+func (vault *Vault) migrateRole(service Service, role string) (string, error) {
+	legacy := legacyRolePath(service, role)
+	if legacy == "" {
+		return "", nil
+	}
+
+	stored, err := vault.readLegacyRole(legacy)
+	if err != nil || stored == nil {
+		return "", err
+	}
+
+	// only a legacy role granting what the service's role grants is its own
+	var mismatches []string
+	if *deleteLegacyRoles {
+		mismatches, err = legacyRoleMismatches(service, stored)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if vault.ReadOnly {
+		switch {
+		case len(mismatches) > 0:
+			return fmt.Sprintf("role %s would be migrated to %s but not deleted, it differs: %s", legacy, role, strings.Join(mismatches, "; ")), nil
+		case *deleteLegacyRoles:
+			return fmt.Sprintf("role %s would be migrated to %s and deleted", legacy, role), nil
+		}
+		return fmt.Sprintf("role %s would be migrated to %s", legacy, role), nil
+	}
+
+	if !*deleteLegacyRoles {
+		return fmt.Sprintf("role %s migrated to %s, the legacy role is kept", legacy, role), nil
+	}
+	if len(mismatches) > 0 {
+		return fmt.Sprintf("role %s migrated to %s, the legacy role is kept as it differs: %s", legacy, role, strings.Join(mismatches, "; ")), nil
+	}
+	if err := vault.delete(legacy); err != nil {
+		return "", fmt.Errorf("deleting legacy role %s: %v", legacy, err)
+	}
+	return fmt.Sprintf("role %s migrated to %s and deleted", legacy, role), nil
+}
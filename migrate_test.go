@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// legacyRoleServer returns a Vault server storing role at every path,
+// counting the deletes in deletes
+func legacyRoleServer(t *testing.T, role map[string]interface{}, deletes *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			*deletes++
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": role}); err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestMigrateRoleDeletesOnlyMatchingRoles(t *testing.T) {
+	defer setFlag(t, "migrate-role-paths", "true")()
+	defer setFlag(t, "delete-legacy-roles", "true")()
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		policies   []string
+		deleted    bool
+	}{
+		{"matching", []string{"shop"}, []string{"prod-shop-api", "default"}, true},
+		{"other namespaces", []string{"dshop"}, []string{"default", "prod-shop-api"}, false},
+		{"other policies", []string{"shop"}, []string{"default", "pro-dshop-api"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var deletes int
+			server := legacyRoleServer(t, map[string]interface{}{
+				"bound_service_account_names":      []string{"api"},
+				"bound_service_account_namespaces": test.namespaces,
+				"policies":                         test.policies,
+			}, &deletes)
+			defer server.Close()
+
+			vault, err := NewVaultClient(server.URL, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message, err := vault.migrateRole(testService("shop", "api"), "auth/kubernetes/role/prod-shop-api-role")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted := deletes == 1; deleted != test.deleted {
+				t.Errorf("deleted = %v, want %v: %s", deleted, test.deleted, message)
+			}
+			if !test.deleted && !strings.Contains(message, "kept as it differs") {
+				t.Errorf("message = %q, want the legacy role kept", message)
+			}
+		})
+	}
+}
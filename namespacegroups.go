@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var namespaceGroups = flag.String("namespace-groups", "", "semicolon-separated groups of comma-separated namespaces allowed to share a role, e.g. monitoring,logging;shop,shop-jobs, any namespaces when empty")
+
+// parseNamespaceGroups parses -namespace-groups, rejecting empty groups and
+// entries
+func parseNamespaceGroups(value string) ([][]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var groups [][]string
+	for _, group := range strings.Split(value, ";") {
+		namespaces, err := splitList(group)
+		if err != nil {
+			return nil, err
+		}
+		if len(namespaces) == 0 {
+			return nil, fmt.Errorf("empty group in %q", value)
+		}
+		groups = append(groups, namespaces)
+	}
+	return groups, nil
+}
+
+// checkNamespaceGroup fails unless namespaces, bound by a single role, all
+// belong to one -namespace-groups group. A single namespace, or no groups
+// configured, always passes.
+func checkNamespaceGroup(namespaces []string) error {
+	groups, err := parseNamespaceGroups(*namespaceGroups)
+	if err != nil || len(groups) == 0 || len(namespaces) < 2 {
+		return err
+	}
+
+	for _, group := range groups {
+		within := true
+		for _, namespace := range namespaces {
+			if !contains(group, namespace) {
+				within = false
+				break
+			}
+		}
+		if within {
+			return nil
+		}
+	}
+	return fmt.Errorf("namespaces %s are not in one -namespace-groups group", strings.Join(namespaces, ", "))
+}
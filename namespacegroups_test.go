@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestCheckNamespaceGroup(t *testing.T) {
+	defer setFlag(t, "namespace-groups", "monitoring,logging;shop,shop-jobs")()
+
+	tests := []struct {
+		namespaces []string
+		ok         bool
+	}{
+		{[]string{"billing"}, true},
+		{[]string{"logging", "monitoring"}, true},
+		{[]string{"shop", "shop-jobs"}, true},
+		{[]string{"billing", "shop"}, false},
+		{[]string{"logging", "shop"}, false},
+		{[]string{"logging", "monitoring", "shop"}, false},
+	}
+
+	for _, test := range tests {
+		if err := checkNamespaceGroup(test.namespaces); (err == nil) != test.ok {
+			t.Errorf("checkNamespaceGroup(%v) = %v, want ok %v", test.namespaces, err, test.ok)
+		}
+	}
+}
+
+func TestCheckNamespaceGroupEmpty(t *testing.T) {
+	if err := checkNamespaceGroup([]string{"billing", "shop"}); err != nil {
+		t.Errorf("without -namespace-groups got %v, want any namespaces allowed", err)
+	}
+}
+
+func TestParseNamespaceGroups(t *testing.T) {
+	for _, value := range []string{"shop,;ops", "shop;;ops", "shop;"} {
+		if _, err := parseNamespaceGroups(value); err == nil {
+			t.Errorf("parseNamespaceGroups(%q) accepted an empty entry", value)
+		}
+	}
+}
+
+func TestNewServiceBoundNamespaces(t *testing.T) {
+	defer setFlag(t, "namespace-groups", "shop,shop-jobs")()
+
+	deployment := annotatedDeployment("shop", "api", map[string]string{BoundNamespacesAnnotation: "billing"})
+	if _, err := newService(deployment, "prod", nil); err == nil {
+		t.Error("shop/api bound billing outside its namespace group")
+	}
+
+	deployment = annotatedDeployment("shop", "api", map[string]string{BoundNamespacesAnnotation: "shop-jobs"})
+	service, err := newService(deployment, "prod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(service.Namespaces) != 2 {
+		t.Errorf("namespaces = %v, want shop and shop-jobs", service.Namespaces)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var includeTerminating = flag.Bool("include-terminating", false, "process workloads in namespaces being terminated")
+
+// namespacePhases looks up namespace phases, caching them for the run
+type namespacePhases struct {
+	clientset kubernetes.Interface
+	phases    map[string]corev1.NamespacePhase
+}
+
+// newNamespacePhases returns a namespacePhases using clientset
+func newNamespacePhases(clientset kubernetes.Interface) *namespacePhases {
+	return &namespacePhases{
+		clientset: clientset,
+		phases:    map[string]corev1.NamespacePhase{},
+	}
+}
+
+// terminating reports whether namespace is being terminated. A namespace
+// whose phase cannot be read is warned about once and treated as active.
+func (namespaces *namespacePhases) terminating(namespace string) bool {
+	phase, ok := namespaces.phases[namespace]
+	if !ok {
+		ns, err := namespaces.clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if err != nil {
+			fmt.Printf("warning: reading namespace %s: %v, assuming it is active\n", namespace, err)
+			phase = corev1.NamespaceActive
+		} else {
+			phase = ns.Status.Phase
+		}
+		namespaces.phases[namespace] = phase
+	}
+
+	return phase == corev1.NamespaceTerminating
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// roleAuthPath path roles are written below
+const roleAuthPath = "auth/kubernetes/role/"
+
+const (
+	policyNameTmpl = "{{.Context}}{{sep}}{{.Namespace}}{{sep}}{{.Name}}"
+	roleNameTmpl   = "{{.Context}}{{sep}}{{.Namespace}}{{sep}}{{.Name}}{{sep}}role"
+	secretPathTmpl = "{{.Context}}/{{.Namespace}}/{{.Name}}"
+
+	// names of shared identities, the underscore cannot clash with a
+	// namespace or deployment name
+	identityPolicyNameTmpl = "{{.Context}}{{sep}}_identity{{sep}}{{.Name}}"
+	identityRoleNameTmpl   = "{{.Context}}{{sep}}_identity{{sep}}{{.Name}}{{sep}}role"
+
+	// names generated before segments were separated consistently
+	legacyPolicyNameTmpl = "{{.Context}}-{{.Namespace}}-{{.Name}}"
+	legacyRoleNameTmpl   = "{{.Context}}{{.Namespace}}-{{.Name}}-role"
+)
+
+var nameStrategyName = flag.String("name-strategy", "template", "strategy naming generated policies, roles and secret paths: "+strings.Join(nameStrategyNames(), ", "))
+
+// NameStrategy names the Vault objects generated for a service, an empty
+// name means the service cannot be named
+type NameStrategy interface {
+	PolicyName(Service) string
+	RoleName(Service) string
+	// SecretPath subtree below the KV mount the service's secrets live in
+	SecretPath(Service) string
+}
+
+// nameStrategies built-in strategies selectable with -name-strategy
+var nameStrategies = map[string]NameStrategy{
+	"template": templateNames{},
+	"legacy":   legacyNames{},
+}
+
+// names strategy selected for the run
+var names NameStrategy = templateNames{}
+
+// nameStrategyNames returns the names of the built-in strategies in order
+func nameStrategyNames() []string {
+	var strategies []string
+	for name := range nameStrategies {
+		strategies = append(strategies, name)
+	}
+	sort.Strings(strategies)
+	return strategies
+}
+
+// selectNameStrategy returns the built-in strategy called name
+func selectNameStrategy(name string) (NameStrategy, error) {
+	strategy, ok := nameStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown name strategy %q, should be one of %s", name, strings.Join(nameStrategyNames(), ", "))
+	}
+	return strategy, nil
+}
+
+// templateNames default strategy, joining segments with -name-separator
+// and appending -policy-suffix-template to policy names
+type templateNames struct{}
+
+func (templateNames) PolicyName(service Service) string {
+	nameTmpl := policyNameTmpl
+	if service.Identity != "" {
+		nameTmpl = identityPolicyNameTmpl
+	}
+
+	name := service.parseTemplate(nameTmpl)
+	if name == "" || *policySuffixTemplate == "" {
+		return name
+	}
+
+	suffix := service.parseTemplate(*policySuffixTemplate)
+	if suffix == "" {
+		return ""
+	}
+	return name + suffix
+}
+
+func (templateNames) RoleName(service Service) string {
+	if service.Identity != "" {
+		return service.parseTemplate(identityRoleNameTmpl)
+	}
+	return service.parseTemplate(roleNameTmpl)
+}
+
+func (templateNames) SecretPath(service Service) string {
+	return service.parseTemplate(*secretPathTemplate)
+}
+
+// legacyNames names of earlier versions, which concatenated context and
+// namespace in role names
+type legacyNames struct{}
+
+func (legacyNames) PolicyName(service Service) string {
+	return service.parseTemplate(legacyPolicyNameTmpl)
+}
+
+func (legacyNames) RoleName(service Service) string {
+	return service.parseTemplate(legacyRoleNameTmpl)
+}
+
+func (legacyNames) SecretPath(service Service) string {
+	return service.parseTemplate(secretPathTmpl)
+}
+
+// policyName returns the name of the service's policy
+func (service *Service) policyName() string {
+	return names.PolicyName(*service)
+}
+
+// rolePath returns the path of the service's role
+func (service *Service) rolePath() string {
+	name := names.RoleName(*service)
+	if name == "" {
+		return ""
+	}
+	return roleAuthPath + name
+}
+
+// checkNameCollisions fails when two services render the same policy or role
+// name, as the later one would overwrite the objects of the other
+func checkNameCollisions(services []Service) error {
+	var collisions []string
+	policies := map[string]string{}
+	roles := map[string]string{}
+
+	for _, service := range services {
+		// the default service account role is shared by design
+		if *defaultSAPolicy != "" && service.usesDefaultAccount() {
+			continue
+		}
+
+		name := service.Namespace + "/" + service.Name
+		if policy := service.policyName(); policy != "" {
+			if other, ok := policies[policy]; ok {
+				collisions = append(collisions, fmt.Sprintf("policy %s of %s and %s", policy, other, name))
+			}
+			policies[policy] = name
+		}
+
+		// merged services write no role of their own
+		if service.MergedRole != "" {
+			continue
+		}
+		if role := service.rolePath(); role != "" {
+			if other, ok := roles[role]; ok {
+				collisions = append(collisions, fmt.Sprintf("role %s of %s and %s", role, other, name))
+			}
+			roles[role] = name
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("services render the same names: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameSeparatorRegex(t *testing.T) {
+	tests := []struct {
+		separator string
+		valid     bool
+	}{
+		{"-", true},
+		{"_", true},
+		{".", true},
+		{"--", true},
+		{"_-_", true},
+		{"", false},
+		{"/", false},
+		{" ", false},
+		{"-/", false},
+		{"+", false},
+	}
+
+	for _, test := range tests {
+		if got := nameSeparatorRegex.MatchString(test.separator); got != test.valid {
+			t.Errorf("separator %q valid = %v, want %v", test.separator, got, test.valid)
+		}
+	}
+}
+
+func TestTemplateNamesSeparator(t *testing.T) {
+	tests := []struct {
+		separator string
+		policy    string
+		role      string
+	}{
+		{"-", "prod-shop-api", "auth/kubernetes/role/prod-shop-api-role"},
+		{"_", "prod_shop_api", "auth/kubernetes/role/prod_shop_api_role"},
+		{".", "prod.shop.api", "auth/kubernetes/role/prod.shop.api.role"},
+		{"--", "prod--shop--api", "auth/kubernetes/role/prod--shop--api--role"},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer setFlag(t, "name-separator", test.separator)()
+
+			service := testService("shop", "api")
+			if policy := service.policyName(); policy != test.policy {
+				t.Errorf("separator %q: policy = %q, want %q", test.separator, policy, test.policy)
+			}
+			if role := service.rolePath(); role != test.role {
+				t.Errorf("separator %q: role = %q, want %q", test.separator, role, test.role)
+			}
+			// secret paths keep their slashes
+			if path := names.SecretPath(service); path != "prod/shop/api" {
+				t.Errorf("separator %q: secret path = %q, want prod/shop/api", test.separator, path)
+			}
+		}()
+	}
+}
+
+func TestLegacyNames(t *testing.T) {
+	defer setFlag(t, "name-separator", "_")()
+
+	service := testService("shop", "api")
+	if policy := (legacyNames{}).PolicyName(service); policy != "prod-shop-api" {
+		t.Errorf("policy = %q, want prod-shop-api", policy)
+	}
+	if role := (legacyNames{}).RoleName(service); role != "prodshop-api-role" {
+		t.Errorf("role = %q, want prodshop-api-role", role)
+	}
+}
+
+func TestCheckNameCollisions(t *testing.T) {
+	if err := checkNameCollisions([]Service{testService("shop", "api"), testService("shop", "web")}); err != nil {
+		t.Errorf("distinct services: %v", err)
+	}
+
+	// prod-shop-a-b either way
+	err := checkNameCollisions([]Service{testService("shop", "a-b"), testService("shop-a", "b")})
+	if err == nil {
+		t.Fatal("colliding names accepted")
+	}
+	for _, want := range []string{"policy prod-shop-a-b of shop/a-b and shop-a/b", "role auth/kubernetes/role/prod-shop-a-b-role"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+
+	// a merged service writes its policy but not its own role
+	merged := testService("shop-a", "b")
+	merged.MergedRole = "auth/kubernetes/role/prod-shop-api-role"
+	err = checkNameCollisions([]Service{testService("shop", "a-b"), merged})
+	if err == nil || strings.Contains(err.Error(), "role") {
+		t.Errorf("error = %v, want only the policy collision", err)
+	}
+}
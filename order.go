@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var (
+	randomizeOrder = flag.Bool("randomize-order", false, "apply services in a random order, so failures from rate limiting hit different services each run")
+	orderSeed      = flag.Int64("order-seed", 0, "seed of -randomize-order, to reproduce the order of an earlier run, random when 0")
+)
+
+// shuffleServices shuffles services in place, returning the seed used
+func shuffleServices(services []Service, seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(services), func(i, j int) {
+		services[i], services[j] = services[j], services[i]
+	})
+	return seed
+}
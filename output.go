@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	outputDir    = flag.String("output", "", "render every policy as HCL and role as JSON into this directory instead of writing to Vault")
+	outputLayout = flag.String("output-layout", "flat", "directory structure of -output: flat or by-namespace")
+)
+
+// outputLayouts directory of a service's files below -output, by layout
+var outputLayouts = map[string]func(Service) string{
+	"flat":         func(Service) string { return "" },
+	"by-namespace": func(service Service) string { return service.Namespace },
+}
+
+// writeOutput renders the policy and role of every service into dir,
+// returning the errors of services which could not be rendered by name.
+// Workloads using the -default-sa-policy role render that role, bound to
+// audiences, instead.
+func writeOutput(dir string, services []Service, audiences []string) (map[string]error, error) {
+	errs := map[string]error{}
+	layout := outputLayouts[*outputLayout]
+
+	for _, service := range services {
+		name := service.Namespace + "/" + service.Name
+		serviceDir := filepath.Join(dir, layout(service))
+		if err := os.MkdirAll(serviceDir, 0755); err != nil {
+			return nil, err
+		}
+
+		write := writeServiceOutput
+		if *defaultSAPolicy != "" && service.usesDefaultAccount() {
+			write = func(dir string, service Service) error {
+				return writeDefaultSAOutput(dir, service, audiences)
+			}
+		}
+		if err := write(serviceDir, service); err != nil {
+			errs[name] = fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return errs, nil
+}
+
+// writeServiceOutput writes <policy>.hcl and, unless merged into another
+// role, <role>.json of the service into dir
+func writeServiceOutput(dir string, service Service) error {
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		return err
+	}
+	policy := service.policyName()
+	if policy == "" {
+		return errors.New("something wrong with parsing templates")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, policy+".hcl"), []byte(renderPolicy(stanzas)), 0644); err != nil {
+		return err
+	}
+
+	if service.MergedRole != "" {
+		return nil
+	}
+
+	data, err := service.roleData(policy)
+	if err != nil {
+		return err
+	}
+	role := names.RoleName(service)
+	if role == "" {
+		return errors.New("something wrong with parsing templates")
+	}
+	return writeRoleOutput(dir, role, data)
+}
+
+// writeDefaultSAOutput writes <role>.json of the shared default service
+// account role of the service's namespace into dir, the -default-sa-policy
+// policy is not rendered
+func writeDefaultSAOutput(dir string, service Service, audiences []string) error {
+	account := defaultSAAccount(service, audiences)
+	path, err := account.defaultSARolePath()
+	if err != nil {
+		return err
+	}
+	data, err := account.roleData(*defaultSAPolicy)
+	if err != nil {
+		return err
+	}
+	return writeRoleOutput(dir, strings.TrimPrefix(path, roleAuthPath), data)
+}
+
+// writeRoleOutput writes the role fields data as <role>.json into dir
+func writeRoleOutput(dir, role string, data map[string]interface{}) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, role+".json"), append(content, '\n'), 0644)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// outputFiles returns the files below dir, relative to it
+func outputFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestWriteOutputDefaultAccount(t *testing.T) {
+	defer setFlag(t, "default-sa-policy", "shared-readonly")()
+	defer setFlag(t, "output-layout", "by-namespace")()
+
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	web := testService("shop", "web")
+	web.AccountName = DefaultServiceAccountName
+	cron := testService("shop", "cron")
+	cron.AccountName = DefaultServiceAccountName
+
+	errs, err := writeOutput(dir, []Service{testService("shop", "api"), web, cron}, nil)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("writeOutput: %v %v", err, errs)
+	}
+
+	want := []string{
+		"shop/prod-shop-_default-role.json",
+		"shop/prod-shop-api-role.json",
+		"shop/prod-shop-api.hcl",
+	}
+	if files := outputFiles(t, dir); !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
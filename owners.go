@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var (
+	ownerKind       = flag.String("owner-kind", "", "only process deployments directly owned by an object of this kind, e.g. Application")
+	ownerAPIVersion = flag.String("owner-api-version", "", "API version the -owner-kind owner must have, any when empty")
+)
+
+// ownedDeployments returns the deployments directly owned by an object of
+// -owner-kind, all of them when it is not set
+func ownedDeployments(deployments []appsv1.Deployment) []appsv1.Deployment {
+	if *ownerKind == "" {
+		return deployments
+	}
+
+	var owned []appsv1.Deployment
+	for _, deployment := range deployments {
+		for _, owner := range deployment.GetOwnerReferences() {
+			if owner.Kind == *ownerKind && (*ownerAPIVersion == "" || owner.APIVersion == *ownerAPIVersion) {
+				owned = append(owned, deployment)
+				break
+			}
+		}
+	}
+	return owned
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// PhaseAnnotation deployment annotation selecting its lifecycle phase
+const PhaseAnnotation = "vault.io/phase"
+
+// lifecycle phases of a workload's secrets
+const (
+	phaseBootstrap = "bootstrap"
+	phaseRuntime   = "runtime"
+)
+
+var defaultPhase = flag.String("default-phase", phaseRuntime, "phase of workloads without the vault.io/phase annotation, bootstrap or runtime")
+
+// phaseCapabilities capabilities granted on the secret subtree per phase:
+// full access while secrets are created, read-only once they are in use
+var phaseCapabilities = map[string][]string{
+	phaseBootstrap: kvCapabilities,
+	phaseRuntime:   {"read", "list"},
+}
+
+// checkPhase fails for unknown phases
+func checkPhase(phase string) error {
+	if _, ok := phaseCapabilities[phase]; !ok {
+		return fmt.Errorf("unknown phase %q, should be %s or %s", phase, phaseBootstrap, phaseRuntime)
+	}
+	return nil
+}
+
+// phase returns the service's phase, -default-phase when it has none
+func (service *Service) phase() string {
+	if service.Phase == "" {
+		return *defaultPhase
+	}
+	return service.Phase
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	kvMount              = flag.String("kv-mount", "secret", "path the KV secrets engine is mounted at")
+	kvVersion            = flag.Int("kv-version", 2, "version of the KV secrets engine, 1 or 2")
+	policySuffixTemplate = flag.String("policy-suffix-template", "", "template appended to policy names, e.g. -kv{{kvVersion}}")
+	allowedMountPrefixes = flag.String("allowed-mount-prefixes", "", "comma-separated mount prefixes, e.g. secret/,transit/, every generated policy path must start with")
+	transit              = flag.Bool("transit", false, "grant encrypt/decrypt/rewrap on a per-service transit key")
+	transitOnly          = flag.Bool("transit-only", false, "grant only the transit key, without the KV secret paths (implies -transit)")
+	transitMount         = flag.String("transit-mount", "transit", "path the transit secrets engine is mounted at")
+	transitKeyTemplate   = flag.String("transit-key-template", "{{.Context}}{{sep}}{{.Namespace}}{{sep}}{{.Name}}", "template of the per-service transit key name")
+	versionManagement    = flag.Bool("version-management", false, "with KV version 2 also grant deleting, undeleting and destroying versions of the service's secrets")
+	listMetadata         = flag.Bool("list-metadata", false, "with KV version 2 also grant list on the secret subtree's metadata, to browse it in the UI")
+)
+
+// kvCapabilities capabilities granted on the service's secret subtree
+var kvCapabilities = []string{"create", "read", "update", "delete", "list"}
+
+// versionEndpoints KV version 2 endpoints managing secret versions, each
+// written to with update
+var versionEndpoints = []string{"delete", "undelete", "destroy"}
+
+// transitOperations transit endpoints a service may call on its own key
+var transitOperations = []string{"encrypt", "decrypt", "rewrap"}
+
+// policyStanza a single path block of a Vault policy
+type policyStanza struct {
+	Path         string
+	Capabilities []string
+	// ControlGroup approval required to use the path, if any
+	ControlGroup *controlGroupRule
+}
+
+// policyStanzas returns the path blocks granted to the service
+func (service *Service) policyStanzas() ([]policyStanza, error) {
+	var stanzas, denied []policyStanza
+
+	override, err := service.tierOverride()
+	if err != nil {
+		return nil, err
+	}
+
+	// the tier is central policy and wins over the workload's own phase
+	capabilities := phaseCapabilities[service.phase()]
+	if override != nil && len(override.Capabilities) > 0 {
+		capabilities = override.Capabilities
+	}
+
+	if !*transitOnly {
+		// one stanza per bound namespace and deployment, each granting that
+		// deployment's subtree in the namespace
+		for _, namespace := range service.Namespaces {
+			for _, name := range service.subtreeNames() {
+				scoped := *service
+				scoped.Namespace = namespace
+				scoped.Name = name
+
+				subtree := names.SecretPath(scoped)
+				if subtree == "" {
+					return nil, errors.New("something wrong with parsing secret path template")
+				}
+				stanzas = append(stanzas, policyStanza{Path: kvPath("data", subtree) + "/*", Capabilities: capabilities})
+
+				// listing the subtree itself needs the parent path without the glob
+				if *listMetadata && *kvVersion == 2 {
+					stanzas = append(stanzas,
+						policyStanza{Path: kvPath("metadata", subtree), Capabilities: []string{"list"}},
+						policyStanza{Path: kvPath("metadata", subtree) + "/*", Capabilities: []string{"list"}},
+					)
+				}
+
+				if *versionManagement && *kvVersion == 2 {
+					for _, endpoint := range versionEndpoints {
+						stanzas = append(stanzas, policyStanza{Path: kvPath(endpoint, subtree) + "/*", Capabilities: []string{"update"}})
+					}
+				}
+
+				if override != nil {
+					for _, endpoint := range override.Deny {
+						denied = append(denied, policyStanza{Path: kvPath(endpoint, subtree) + "/*", Capabilities: []string{"deny"}})
+					}
+				}
+			}
+		}
+	}
+
+	if *transit || *transitOnly {
+		key := service.parseTemplate(*transitKeyTemplate)
+		if key == "" {
+			return nil, errors.New("something wrong with parsing transit key template")
+		}
+		mount := strings.Trim(*transitMount, "/")
+		for _, operation := range transitOperations {
+			stanzas = append(stanzas, policyStanza{
+				Path:         fmt.Sprintf("%s/%s/%s", mount, operation, key),
+				Capabilities: []string{"update"},
+			})
+		}
+	}
+
+	stanzas = append(stanzas, service.accessStanzas()...)
+
+	for i := range stanzas {
+		stanzas[i].ControlGroup = controlGroupFor(stanzas[i].Path)
+	}
+
+	// deny stanzas go last, after everything the policy grants
+	stanzas = append(stanzas, denied...)
+
+	if err := checkMountPrefixes(stanzas); err != nil {
+		return nil, err
+	}
+
+	return stanzas, nil
+}
+
+// checkMountPrefixes fails when a stanza's path is outside every
+// -allowed-mount-prefixes entry, no prefixes allow any path
+func checkMountPrefixes(stanzas []policyStanza) error {
+	prefixes, err := splitList(*allowedMountPrefixes)
+	if err != nil || len(prefixes) == 0 {
+		return err
+	}
+
+	for _, stanza := range stanzas {
+		allowed := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(stanza.Path, strings.Trim(prefix, "/")+"/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("policy path %q is outside the allowed mount prefixes %v", stanza.Path, prefixes)
+		}
+	}
+
+	return nil
+}
+
+// kvPath returns the API path of subtree below the KV mount, for KV version 2
+// prefixed with the endpoint, e.g. data or metadata
+func kvPath(endpoint, subtree string) string {
+	mount := strings.Trim(*kvMount, "/")
+	if *kvVersion == 1 {
+		return mount + "/" + subtree
+	}
+	return mount + "/" + endpoint + "/" + subtree
+}
+
+// renderPolicy returns the HCL policy document for stanzas
+func renderPolicy(stanzas []policyStanza) string {
+	var rule strings.Builder
+
+	for _, stanza := range stanzas {
+		capabilities := make([]string, len(stanza.Capabilities))
+		for i, capability := range stanza.Capabilities {
+			capabilities[i] = strconv.Quote(capability)
+		}
+
+		fmt.Fprintf(&rule, "path %q {\n  capabilities = [%s]\n", stanza.Path, strings.Join(capabilities, ", "))
+		if stanza.ControlGroup != nil {
+			renderControlGroup(&rule, stanza.ControlGroup)
+		}
+		rule.WriteString("}\n\n")
+	}
+
+	return rule.String()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicyStanzasTierDeny(t *testing.T) {
+	previous := tierOverrides
+	defer func() {
+		tierOverrides = previous
+	}()
+	tierOverrides = map[string]tierOverride{
+		"prod": {
+			Capabilities: []string{"create", "read", "update", "list"},
+			Deny:         []string{"delete", "destroy"},
+		},
+	}
+
+	service := testService("shop", "api")
+	service.Tier = "prod"
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []policyStanza{
+		{Path: "secret/data/prod/shop/api/*", Capabilities: []string{"create", "read", "update", "list"}},
+		{Path: "secret/delete/prod/shop/api/*", Capabilities: []string{"deny"}},
+		{Path: "secret/destroy/prod/shop/api/*", Capabilities: []string{"deny"}},
+	}
+	if !reflect.DeepEqual(stanzas, want) {
+		t.Errorf("stanzas = %+v, want %+v", stanzas, want)
+	}
+}
+
+func TestPolicyStanzasPhases(t *testing.T) {
+	previous := tierOverrides
+	defer func() {
+		tierOverrides = previous
+	}()
+	tierOverrides = map[string]tierOverride{
+		"audited": {Capabilities: []string{"read"}},
+		"denying": {Deny: []string{"destroy"}},
+	}
+
+	tests := []struct {
+		name  string
+		phase string
+		tier  string
+		want  []string
+	}{
+		{"default phase", "", "", []string{"read", "list"}},
+		{"runtime", phaseRuntime, "", []string{"read", "list"}},
+		{"bootstrap", phaseBootstrap, "", kvCapabilities},
+		{"tier over bootstrap", phaseBootstrap, "audited", []string{"read"}},
+		{"tier over runtime", phaseRuntime, "audited", []string{"read"}},
+		{"tier without capabilities", phaseBootstrap, "denying", kvCapabilities},
+	}
+
+	for _, test := range tests {
+		service := testService("shop", "api")
+		service.Phase = test.phase
+		service.Tier = test.tier
+
+		stanzas, err := service.policyStanzas()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if stanzas[0].Path != "secret/data/prod/shop/api/*" || !reflect.DeepEqual(stanzas[0].Capabilities, test.want) {
+			t.Errorf("%s: stanza %+v, want %v on secret/data/prod/shop/api/*", test.name, stanzas[0], test.want)
+		}
+	}
+}
+
+func TestPolicyStanzasDefaultPhase(t *testing.T) {
+	defer setFlag(t, "default-phase", phaseBootstrap)()
+
+	service := testService("shop", "api")
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stanzas[0].Capabilities, kvCapabilities) {
+		t.Errorf("capabilities = %v, want %v", stanzas[0].Capabilities, kvCapabilities)
+	}
+}
+
+func TestPolicyStanzasListMetadata(t *testing.T) {
+	defer setFlag(t, "list-metadata", "true")()
+
+	service := testService("shop", "api")
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []policyStanza{
+		{Path: "secret/data/prod/shop/api/*", Capabilities: []string{"read", "list"}},
+		{Path: "secret/metadata/prod/shop/api", Capabilities: []string{"list"}},
+		{Path: "secret/metadata/prod/shop/api/*", Capabilities: []string{"list"}},
+	}
+	if !reflect.DeepEqual(stanzas, want) {
+		t.Errorf("stanzas = %+v, want %+v", stanzas, want)
+	}
+}
+
+func TestPolicyStanzasListMetadataKV1(t *testing.T) {
+	defer setFlag(t, "list-metadata", "true")()
+	defer setFlag(t, "kv-version", "1")()
+
+	service := testService("shop", "api")
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stanzas) != 1 || stanzas[0].Path != "secret/prod/shop/api/*" {
+		t.Errorf("stanzas = %+v, want only the KV version 1 subtree", stanzas)
+	}
+}
+
+func TestPolicyStanzasVersionManagement(t *testing.T) {
+	defer setFlag(t, "version-management", "true")()
+
+	service := testService("shop", "api")
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []policyStanza{
+		{Path: "secret/data/prod/shop/api/*", Capabilities: []string{"read", "list"}},
+		{Path: "secret/delete/prod/shop/api/*", Capabilities: []string{"update"}},
+		{Path: "secret/undelete/prod/shop/api/*", Capabilities: []string{"update"}},
+		{Path: "secret/destroy/prod/shop/api/*", Capabilities: []string{"update"}},
+	}
+	if !reflect.DeepEqual(stanzas, want) {
+		t.Errorf("stanzas = %+v, want %+v", stanzas, want)
+	}
+}
+
+func TestPolicyStanzasVersionManagementDenied(t *testing.T) {
+	defer setFlag(t, "version-management", "true")()
+	previous := tierOverrides
+	defer func() {
+		tierOverrides = previous
+	}()
+	tierOverrides = map[string]tierOverride{"prod": {Deny: []string{"destroy"}}}
+
+	service := testService("shop", "api")
+	service.Tier = "prod"
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deny stanza comes last and wins over the granted destroy
+	last := stanzas[len(stanzas)-1]
+	if last.Path != "secret/destroy/prod/shop/api/*" || !reflect.DeepEqual(last.Capabilities, []string{"deny"}) {
+		t.Errorf("last stanza = %+v, want destroy denied", last)
+	}
+}
+
+func TestPolicyStanzasVersionManagementKV1(t *testing.T) {
+	defer setFlag(t, "version-management", "true")()
+	defer setFlag(t, "kv-version", "1")()
+
+	service := testService("shop", "api")
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stanzas) != 1 {
+		t.Errorf("stanzas = %+v, want only the KV version 1 subtree", stanzas)
+	}
+}
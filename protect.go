@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	protectedVaultPattern = flag.String("protected-vault-pattern", "", "regular expression of Vault addresses, e.g. production, which are only written to with -confirm-vault-addr")
+	confirmVaultAddr      = flag.String("confirm-vault-addr", "", "address of the protected Vault server the run is meant to write to")
+)
+
+// checkProtectedAddr fails when addr matches -protected-vault-pattern and
+// was not confirmed with -confirm-vault-addr
+func checkProtectedAddr(addr string) error {
+	if *protectedVaultPattern == "" {
+		return nil
+	}
+
+	// the pattern is validated before any connection is made
+	protected := regexp.MustCompile(*protectedVaultPattern)
+	if !protected.MatchString(addr) {
+		return nil
+	}
+
+	if strings.TrimRight(*confirmVaultAddr, "/") != strings.TrimRight(addr, "/") {
+		return fmt.Errorf("Vault %s is protected, repeat its address with -confirm-vault-addr to write to it", addr)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var reportFormat = flag.String("report", "", "print what would be written for every service as json or csv and exit, without contacting Vault")
+
+// reportEntry what the tool would write to Vault for a single service
+type reportEntry struct {
+	RunID           string   `json:"run_id"`
+	Context         string   `json:"context"`
+	Namespace       string   `json:"namespace"`
+	Name            string   `json:"name"`
+	ServiceAccount  string   `json:"service_account"`
+	BoundNamespaces []string `json:"bound_namespaces"`
+	BoundAccounts   []string `json:"bound_service_accounts"`
+	Role            string   `json:"role"`
+	Policy          string   `json:"policy"`
+	// Policies the final list attached to the role
+	Policies []string `json:"policies"`
+}
+
+// newReportEntry returns the report entry of service, workloads using the
+// -default-sa-policy role report that role instead of their own and merged
+// services the role they were merged into, with its policies from roles
+func newReportEntry(service Service, roles map[string][]string) reportEntry {
+	if *defaultSAPolicy != "" && service.usesDefaultAccount() {
+		account := defaultSAAccount(service, nil)
+		role, _ := account.defaultSARolePath()
+		return reportEntry{
+			RunID:           runID,
+			Context:         service.Context,
+			Namespace:       service.Namespace,
+			Name:            service.Name,
+			ServiceAccount:  service.AccountName,
+			BoundNamespaces: account.Namespaces,
+			BoundAccounts:   account.boundAccountNames(),
+			Role:            role,
+			Policy:          *defaultSAPolicy,
+			Policies:        account.rolePolicies(*defaultSAPolicy),
+		}
+	}
+
+	policy := service.policyName()
+	role := service.rolePath()
+	policies := service.rolePolicies(policy)
+	if service.MergedRole != "" {
+		role = service.MergedRole
+		policies = roles[role]
+	}
+
+	return reportEntry{
+		RunID:           runID,
+		Context:         service.Context,
+		Namespace:       service.Namespace,
+		Name:            service.Name,
+		ServiceAccount:  service.AccountName,
+		BoundNamespaces: service.Namespaces,
+		BoundAccounts:   service.boundAccountNames(),
+		Role:            role,
+		Policy:          policy,
+		Policies:        policies,
+	}
+}
+
+// writeReport writes the report of services to w in format json or csv
+func writeReport(w io.Writer, format string, services []Service) error {
+	// policies of the roles services were merged into
+	roles := map[string][]string{}
+	for _, service := range services {
+		if service.MergedRole == "" {
+			roles[service.rolePath()] = service.rolePolicies(service.policyName())
+		}
+	}
+
+	entries := make([]reportEntry, 0, len(services))
+	for _, service := range services {
+		entries = append(entries, newReportEntry(service, roles))
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "csv":
+		return writeReportCSV(w, entries)
+	}
+
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// writeReportCSV writes entries as CSV, list fields are joined with ";"
+func writeReportCSV(w io.Writer, entries []reportEntry) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"run_id", "context", "namespace", "name", "service_account", "bound_namespaces", "bound_service_accounts", "role", "policy", "policies"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		record := []string{
+			entry.RunID,
+			entry.Context,
+			entry.Namespace,
+			entry.Name,
+			entry.ServiceAccount,
+			strings.Join(entry.BoundNamespaces, ";"),
+			strings.Join(entry.BoundAccounts, ";"),
+			entry.Role,
+			entry.Policy,
+			strings.Join(entry.Policies, ";"),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
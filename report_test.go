@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewReportEntryDefaultAccount(t *testing.T) {
+	defer setFlag(t, "default-sa-policy", "shared-readonly")()
+
+	service := testService("shop", "api")
+	service.AccountName = DefaultServiceAccountName
+
+	entry := newReportEntry(service, nil)
+	if entry.Role != "auth/kubernetes/role/prod-shop-_default-role" {
+		t.Errorf("role = %q, want the shared default service account role", entry.Role)
+	}
+	if entry.Policy != "shared-readonly" {
+		t.Errorf("policy = %q, want shared-readonly", entry.Policy)
+	}
+	if want := []string{"default", "shared-readonly"}; !reflect.DeepEqual(entry.Policies, want) {
+		t.Errorf("policies = %v, want %v", entry.Policies, want)
+	}
+}
+
+func TestNewReportEntryOwnAccount(t *testing.T) {
+	defer setFlag(t, "default-sa-policy", "shared-readonly")()
+
+	entry := newReportEntry(testService("shop", "api"), nil)
+	if entry.Role != "auth/kubernetes/role/prod-shop-api-role" {
+		t.Errorf("role = %q, want the service's own role", entry.Role)
+	}
+	if want := []string{"default", "prod-shop-api"}; !reflect.DeepEqual(entry.Policies, want) {
+		t.Errorf("policies = %v, want %v", entry.Policies, want)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+)
+
+// vaultStatusRegex extracts the HTTP status from errors returned by the
+// Vault API client, which only reports it within the error text
+var vaultStatusRegex = regexp.MustCompile(`Code: (\d{3})\.`)
+
+// vaultStatusCode returns the HTTP status of a Vault API error, 0 when err
+// does not carry one
+func vaultStatusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	match := vaultStatusRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+
+	code, _ := strconv.Atoi(match[1])
+	return code
+}
+
+// IsRetryable reports whether err is transient and the failed call may
+// succeed when repeated. Retryable are Vault responses 408, 429 and 5xx
+// other than 501, network timeouts, refused or reset connections and
+// context deadlines; context cancellation and all other errors are not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// unwrap the errors returned by http.Client and net
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+			continue
+		case *net.OpError:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+			continue
+		case *os.SyscallError:
+			err = e.Err
+			continue
+		}
+		break
+	}
+
+	switch err {
+	case context.Canceled:
+		return false
+	case context.DeadlineExceeded:
+		return true
+	case syscall.ECONNREFUSED, syscall.ECONNRESET:
+		return true
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	switch code := vaultStatusCode(err); {
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code == http.StatusNotImplemented:
+		return false
+	case code >= 500 && code <= 599:
+		return true
+	}
+
+	return false
+}
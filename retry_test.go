@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// vaultError returns an error formatted like the Vault API client's
+func vaultError(code int) error {
+	return fmt.Errorf("Error making API request.\n\nURL: PUT https://vault:8200/v1/sys/policy/p\nCode: %d. Errors:\n\n* error", code)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other error", errors.New("permission denied"), false},
+		{"408", vaultError(408), true},
+		{"429", vaultError(429), true},
+		{"500", vaultError(500), true},
+		{"501", vaultError(501), false},
+		{"503", vaultError(503), true},
+		{"403", vaultError(403), false},
+		{"404", vaultError(404), false},
+		{"timeout", timeoutError{}, true},
+		{"op timeout", &net.OpError{Op: "dial", Err: timeoutError{}}, true},
+		{"url op timeout", &url.Error{Op: "Put", URL: "https://vault:8200", Err: &net.OpError{Op: "read", Err: timeoutError{}}}, true},
+		{"connection refused", &url.Error{Op: "Put", URL: "https://vault:8200", Err: &net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}}, true},
+		{"connection reset", &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, true},
+		{"op other error", &net.OpError{Op: "dial", Err: errors.New("no such host")}, false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"url deadline exceeded", &url.Error{Op: "Put", URL: "https://vault:8200", Err: context.DeadlineExceeded}, true},
+		{"canceled", context.Canceled, false},
+		{"url canceled", &url.Error{Op: "Put", URL: "https://vault:8200", Err: context.Canceled}, false},
+	}
+
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+func TestVaultStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{vaultError(503), 503},
+		{vaultError(404), 404},
+		{errors.New("Code: 5."), 0},
+		{errors.New("connection refused"), 0},
+		{nil, 0},
+	}
+
+	for _, test := range tests {
+		if got := vaultStatusCode(test.err); got != test.want {
+			t.Errorf("vaultStatusCode(%q) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"time"
+)
+
+var runIDFlag = flag.String("run-id", "", "identifier of this run recorded in the summary, report, markers and index, generated when empty")
+
+// runID identifier of the current run, set at startup
+var runID string
+
+// newRunID returns a unique, time ordered run identifier
+func newRunID() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// the timestamp alone still identifies the run
+		return time.Now().UTC().Format("20060102T150405Z")
+	}
+
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// servicePrintf prints a line about a single service prefixed with the run ID,
+// so the lines of a run can be told apart in aggregated logs
+func servicePrintf(format string, args ...interface{}) {
+	fmt.Printf("%s "+format+"\n", append([]interface{}{runID}, args...)...)
+}
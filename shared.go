@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// sharedSecretPathTmpl subtree every service account of a namespace may read,
+// the underscore cannot clash with a deployment name
+const sharedSecretPathTmpl = "{{.Context}}/{{.Namespace}}/_shared"
+
+var (
+	sharedNamespacePolicy    = flag.Bool("shared-namespace-policy", false, "generate a read-only policy per namespace for its shared secrets and attach it to every role in the namespace")
+	sharedPolicyNameTemplate = flag.String("shared-policy-name-template", "{{.Context}}{{sep}}{{.Namespace}}{{sep}}_shared", "template of the per-namespace shared policy name")
+	sharedPolicyCapabilities = []string{"read", "list"}
+)
+
+// namespaceService returns the service standing for the whole namespace
+func namespaceService(context, namespace string) Service {
+	return Service{Context: context, Namespace: namespace}
+}
+
+// sharedPolicyNames returns the shared policies of every namespace the
+// service's role is bound to, none when they are disabled
+func (service *Service) sharedPolicyNames() []string {
+	if !*sharedNamespacePolicy {
+		return nil
+	}
+
+	var names []string
+	for _, namespace := range service.Namespaces {
+		shared := namespaceService(service.Context, namespace)
+		names = append(names, shared.parseTemplate(*sharedPolicyNameTemplate))
+	}
+	return names
+}
+
+// sharedPolicy returns the name and rule of the namespace's shared policy
+func sharedPolicy(context, namespace string) (string, string, error) {
+	shared := namespaceService(context, namespace)
+
+	name := shared.parseTemplate(*sharedPolicyNameTemplate)
+	subtree := shared.parseTemplate(sharedSecretPathTmpl)
+	if name == "" || subtree == "" {
+		return "", "", errors.New("something wrong with parsing shared policy templates")
+	}
+
+	stanzas := []policyStanza{{Path: kvPath("data", subtree) + "/*", Capabilities: sharedPolicyCapabilities}}
+	if err := checkMountPrefixes(stanzas); err != nil {
+		return "", "", err
+	}
+
+	return name, renderPolicy(stanzas), nil
+}
+
+// sharedPolicyWriter writes each namespace's shared policy once per run
+type sharedPolicyWriter struct {
+	vault   *Vault
+	written map[string]error
+}
+
+// newSharedPolicyWriter returns a sharedPolicyWriter using vault
+func newSharedPolicyWriter(vault *Vault) *sharedPolicyWriter {
+	return &sharedPolicyWriter{
+		vault:   vault,
+		written: map[string]error{},
+	}
+}
+
+// ensure writes the shared policies of the service's namespaces not yet
+// written in this run, returning the error of any which failed
+func (writer *sharedPolicyWriter) ensure(service Service) error {
+	for _, namespace := range service.Namespaces {
+		// the same namespace may need its shared policy in several Vault namespaces
+		key := writer.vault.namespace + "|" + namespace
+		err, ok := writer.written[key]
+		if !ok {
+			var name, rule string
+			name, rule, err = sharedPolicy(service.Context, namespace)
+			if err == nil && !writer.vault.changes.skip(writer.vault.objectKey("policy", name), rule) {
+				err = writer.vault.putPolicy(name, rule)
+				if err == nil {
+					writer.vault.changes.applied(writer.vault.objectKey("policy", name), rule)
+				}
+			}
+			writer.written[key] = err
+		}
+		if err != nil {
+			return fmt.Errorf("shared policy of namespace %s: %v", namespace, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSharedPolicy(t *testing.T) {
+	name, rule, err := sharedPolicy("prod", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "prod-shop-_shared" {
+		t.Errorf("name = %q, want prod-shop-_shared", name)
+	}
+
+	want := `path "secret/data/prod/shop/_shared/*" {
+  capabilities = ["read", "list"]
+}
+
+`
+	if rule != want {
+		t.Errorf("rule\n%s\nwant\n%s", rule, want)
+	}
+}
+
+func TestSharedPolicyMountPrefixes(t *testing.T) {
+	defer setFlag(t, "allowed-mount-prefixes", "kv/")()
+
+	if _, _, err := sharedPolicy("prod", "shop"); err == nil {
+		t.Error("shared policy outside -allowed-mount-prefixes accepted")
+	}
+}
+
+func TestSharedPolicyNames(t *testing.T) {
+	service := testService("shop", "api")
+	service.Namespaces = []string{"ops", "shop"}
+
+	if policies := service.sharedPolicyNames(); policies != nil {
+		t.Errorf("policies = %v without -shared-namespace-policy, want none", policies)
+	}
+
+	defer setFlag(t, "shared-namespace-policy", "true")()
+	if want := []string{"prod-ops-_shared", "prod-shop-_shared"}; !reflect.DeepEqual(service.sharedPolicyNames(), want) {
+		t.Errorf("policies = %v, want %v", service.sharedPolicyNames(), want)
+	}
+	if want := []string{"default", "prod-shop-api", "prod-ops-_shared", "prod-shop-_shared"}; !reflect.DeepEqual(service.rolePolicies("prod-shop-api"), want) {
+		t.Errorf("role policies = %v, want %v", service.rolePolicies("prod-shop-api"), want)
+	}
+
+	defer setFlag(t, "shared-policy-name-template", "{{.Namespace}}{{sep}}common")()
+	if want := []string{"ops-common", "shop-common"}; !reflect.DeepEqual(service.sharedPolicyNames(), want) {
+		t.Errorf("policies = %v, want %v", service.sharedPolicyNames(), want)
+	}
+}
+
+func TestSharedPolicyDeploymentNamedShared(t *testing.T) {
+	defer setFlag(t, "shared-namespace-policy", "true")()
+
+	service := testService("shop", "shared")
+	if policy := service.policyName(); reflect.DeepEqual(service.sharedPolicyNames(), []string{policy}) {
+		t.Errorf("deployment shared owns the shared policy %s", policy)
+	}
+	if path := names.SecretPath(service); path == "prod/shop/_shared" {
+		t.Errorf("deployment shared owns the shared subtree %s", path)
+	}
+}
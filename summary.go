@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// result statuses of a service
+const (
+	statusApplied = "applied"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+// serviceResult outcome of a single service
+type serviceResult struct {
+	// Name namespace/name of the service
+	Name    string
+	Status  string
+	Message string
+	Elapsed time.Duration
+}
+
+// runSummary outcome of a run across all discovered services
+type runSummary struct {
+	RunID    string
+	Services int
+	Applied  int
+	Skipped  int
+	Failures []string
+	Results  []serviceResult
+}
+
+// succeeded records a service whose policy and role were written
+func (summary *runSummary) succeeded(name string, elapsed time.Duration) {
+	summary.Services++
+	summary.Applied++
+	summary.Results = append(summary.Results, serviceResult{Name: name, Status: statusApplied, Elapsed: elapsed})
+}
+
+// skipped records a service which was deliberately not applied
+func (summary *runSummary) skipped(name, reason string) {
+	summary.Services++
+	summary.Skipped++
+	summary.Results = append(summary.Results, serviceResult{Name: name, Status: statusSkipped, Message: reason})
+}
+
+// failed records a service which could not be applied
+func (summary *runSummary) failed(name string, err error, elapsed time.Duration) {
+	summary.Services++
+	summary.Failures = append(summary.Failures, err.Error())
+	summary.Results = append(summary.Results, serviceResult{Name: name, Status: statusFailed, Message: err.Error(), Elapsed: elapsed})
+}
+
+// String one line summary of the run
+func (summary *runSummary) String() string {
+	line := fmt.Sprintf("run %s: %d services: %d applied, %d skipped, %d failed", summary.RunID, summary.Services, summary.Applied, summary.Skipped, len(summary.Failures))
+	if len(summary.Failures) > 0 {
+		line += " (" + strings.Join(summary.Failures, "; ") + ")"
+	}
+	return line
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+)
+
+// TierAnnotation deployment annotation selecting its entry in -tier-overrides
+const TierAnnotation = "vault.io/tier"
+
+var tierOverridesFile = flag.String("tier-overrides", "", "JSON file with per-tier capabilities and denied KV endpoints")
+
+// tierOverrides loaded -tier-overrides, by tier name
+var tierOverrides map[string]tierOverride
+
+// vaultCapabilities capabilities understood by Vault policies
+var vaultCapabilities = map[string]bool{
+	"create": true, "read": true, "update": true, "delete": true, "list": true, "sudo": true, "deny": true,
+}
+
+// tierOverride policy settings of a tier
+type tierOverride struct {
+	// Capabilities granted on the secret subtree instead of the defaults
+	Capabilities []string `json:"capabilities"`
+	// Deny KV version 2 endpoints, e.g. delete or destroy, explicitly
+	// denied on the secret subtree, overriding grants of any other policy
+	Deny []string `json:"deny"`
+}
+
+// loadTierOverrides reads and validates the tier overrides file, an empty
+// path returns no overrides
+func loadTierOverrides(path string) (map[string]tierOverride, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides map[string]tierOverride
+	if err := json.Unmarshal(content, &overrides); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	for tier, override := range overrides {
+		for _, capability := range override.Capabilities {
+			if !vaultCapabilities[capability] {
+				return nil, fmt.Errorf("tier %q: unknown capability %q", tier, capability)
+			}
+		}
+		if len(override.Deny) > 0 && *kvVersion == 1 {
+			return nil, fmt.Errorf("tier %q: deny needs KV version 2 endpoints", tier)
+		}
+		for _, endpoint := range override.Deny {
+			if endpoint == "" || endpoint == "data" {
+				return nil, fmt.Errorf("tier %q: cannot deny endpoint %q", tier, endpoint)
+			}
+		}
+	}
+
+	return overrides, nil
+}
+
+// tierOverride returns the override of the service's tier, nil when it has none
+func (service *Service) tierOverride() (*tierOverride, error) {
+	if service.Tier == "" || tierOverrides == nil {
+		return nil, nil
+	}
+
+	override, ok := tierOverrides[service.Tier]
+	if !ok {
+		return nil, fmt.Errorf("tier %q is not defined in %s", service.Tier, *tierOverridesFile)
+	}
+	return &override, nil
+}
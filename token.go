@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var expectedRunDuration = flag.Duration("expected-run-duration", 5*time.Minute, "warn when the Vault token expires sooner than this")
+
+// checkToken looks up the client's own token, failing when it is unusable
+// and warning when it expires before a run of runDuration would finish
+func (vault *Vault) checkToken(runDuration time.Duration) error {
+	vault.use("auth/token/lookup-self", "read")
+	secret, err := vault.client.Auth().Token().LookupSelf()
+	if err != nil {
+		return fmt.Errorf("Vault token is not usable, check VAULT_TOKEN and -vault-addr: %v", err)
+	}
+	if secret == nil {
+		return fmt.Errorf("Vault token is not usable: empty token lookup response")
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return fmt.Errorf("reading Vault token TTL: %v", err)
+	}
+
+	// a zero TTL is a token which never expires
+	if ttl > 0 && ttl < runDuration {
+		fmt.Printf("warning: Vault token expires in %s, shorter than the expected run duration %s\n", ttl, runDuration)
+	}
+
+	return nil
+}
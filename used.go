@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"sort"
+)
+
+var printUsedCapabilities = flag.Bool("print-used-capabilities", false, "print the Vault paths and capabilities the run used, as a policy for the tool's own token")
+
+// usedCapabilities capabilities of each Vault path the run called, keyed by
+// the path including its Vault namespace
+type usedCapabilities map[string]map[string]bool
+
+// use records that the client called path, needing capabilities, in its
+// current Vault namespace
+func (vault *Vault) use(path string, capabilities ...string) {
+	if vault.namespace != "" {
+		path = vault.namespace + "/" + path
+	}
+
+	if vault.used[path] == nil {
+		vault.used[path] = map[string]bool{}
+	}
+	for _, capability := range capabilities {
+		vault.used[path][capability] = true
+	}
+}
+
+// stanzas returns the used capabilities as path blocks in path order
+func (used usedCapabilities) stanzas() []policyStanza {
+	var paths []string
+	for path := range used {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	stanzas := make([]policyStanza, 0, len(paths))
+	for _, path := range paths {
+		stanzas = append(stanzas, policyStanza{Path: path, Capabilities: sortedKeys(used[path])})
+	}
+	return stanzas
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+var (
+	validateOnly    = flag.Bool("validate-only", false, "render every template against a sample service, validate the output and exit")
+	sampleName      = flag.String("sample-name", "sample-app", "deployment name of the -validate-only sample service")
+	sampleNamespace = flag.String("sample-namespace", "default", "namespace of the -validate-only sample service")
+	sampleContext   = flag.String("sample-context", "sample-context", "kubeconfig context of the -validate-only sample service")
+	sampleTier      = flag.String("sample-tier", "", "tier of the -validate-only sample service")
+)
+
+// vaultNameRegex names Vault accepts for roles, same as its generic name pattern
+var vaultNameRegex = regexp.MustCompile(`^\w(([\w-.]+)?\w)?$`)
+
+// sampleService returns the synthetic service used by -validate-only
+func sampleService() Service {
+	labels := map[string]string{}
+	for _, key := range referencedLabels() {
+		labels[key] = "sample"
+	}
+
+	return Service{
+		Name:        *sampleName,
+		Context:     *sampleContext,
+		Namespace:   *sampleNamespace,
+		AccountName: DefaultServiceAccountName,
+		Namespaces:  []string{*sampleNamespace},
+		Tier:        *sampleTier,
+		Labels:      labels,
+	}
+}
+
+// validateName checks name is usable as a Vault role or policy name
+func validateName(kind, name string) error {
+	if !vaultNameRegex.MatchString(name) {
+		return fmt.Errorf("%s %q is not a valid Vault name", kind, name)
+	}
+	if name == "default" || name == "root" {
+		return fmt.Errorf("%s %q is reserved by Vault", kind, name)
+	}
+	return nil
+}
+
+// validateTemplates renders every template against service, writes the
+// results to w and returns an error describing every failure
+func validateTemplates(w io.Writer, service Service) error {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	policyName := service.policyName()
+	fmt.Fprintf(w, "policy name: %s\n", policyName)
+	if err := validateName("policy name", policyName); err != nil {
+		fail("%v", err)
+	}
+
+	rolePath := service.rolePath()
+	fmt.Fprintf(w, "role path:   %s\n", rolePath)
+	if err := validateName("role name", path.Base(rolePath)); err != nil {
+		fail("%v", err)
+	}
+
+	if *vaultNamespaceTemplate != "" {
+		namespace, err := service.vaultNamespace()
+		fmt.Fprintf(w, "vault namespace: %s\n", namespace)
+		if err != nil {
+			fail("%v", err)
+		}
+	}
+
+	stanzas, err := service.policyStanzas()
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, stanza := range stanzas {
+		if strings.Contains(stanza.Path, "//") || strings.HasPrefix(stanza.Path, "/") {
+			fail("policy path %q has an empty segment", stanza.Path)
+		}
+	}
+
+	rule := renderPolicy(stanzas)
+	fmt.Fprintf(w, "policy rule:\n%s", rule)
+	if _, err := hcl.Parse(rule); err != nil {
+		fail("policy rule is not valid HCL: %v", err)
+	}
+
+	if *sharedNamespacePolicy {
+		name, rule, err := sharedPolicy(service.Context, service.Namespace)
+		if err != nil {
+			fail("%v", err)
+		}
+		fmt.Fprintf(w, "shared policy name: %s\nshared policy rule:\n%s", name, rule)
+		if err := validateName("shared policy name", name); err != nil {
+			fail("%v", err)
+		}
+		if _, err := hcl.Parse(rule); err != nil {
+			fail("shared policy rule is not valid HCL: %v", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidateTemplates(t *testing.T) {
+	if err := validateTemplates(ioutil.Discard, testService("shop", "api")); err != nil {
+		t.Errorf("default templates failed: %v", err)
+	}
+}
+
+func TestValidateTemplatesVaultNamespace(t *testing.T) {
+	tests := []struct {
+		template string
+		labels   map[string]string
+		err      string
+	}{
+		{"teams/{{.Namespace}}", nil, ""},
+		{"teams/{{.Labels.team}}", map[string]string{"team": "payments"}, ""},
+		{"{{.Labels.team}}", map[string]string{"team": ""}, "something wrong"},
+		{"teams/{{.Labels.team}}/apps", map[string]string{"team": ""}, "empty segment"},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer setFlag(t, "vault-namespace-template", test.template)()
+
+			service := testService("shop", "api")
+			service.Labels = test.labels
+
+			var output strings.Builder
+			err := validateTemplates(&output, service)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("%s: %v", test.template, err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("%s: error %v, want one containing %q", test.template, err, test.err)
+			}
+			if !strings.Contains(output.String(), "vault namespace: ") {
+				t.Errorf("%s: output lacks the vault namespace", test.template)
+			}
+		}()
+	}
+}
+
+func TestValidateTemplatesEmptySegment(t *testing.T) {
+	defer setFlag(t, "secret-path-template", "{{.Context}}//{{.Name}}")()
+
+	err := validateTemplates(ioutil.Discard, testService("shop", "api"))
+	if err == nil || !strings.Contains(err.Error(), "empty segment") {
+		t.Errorf("error = %v, want an empty segment", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// vaultProxyPasswordEnv environment variable holding the password of
+// -vault-proxy-user, kept off the command line
+const vaultProxyPasswordEnv = "VAULT_PROXY_PASSWORD"
+
+var (
+	vaultProxy               = flag.String("vault-proxy", "", "HTTP(S) proxy URL to reach Vault through, instead of HTTPS_PROXY")
+	vaultProxyUser           = flag.String("vault-proxy-user", "", "user authenticating to -vault-proxy, the password is read from $"+vaultProxyPasswordEnv)
+	vaultTimeout             = flag.Duration("vault-timeout", 0, "timeout of a whole Vault request, the Vault client's default of 60s when 0")
+	vaultDialTimeout         = flag.Duration("vault-dial-timeout", 0, "timeout of connecting to Vault or the proxy, the default transport's when 0")
+	vaultKeepAlive           = flag.Duration("vault-keepalive", 0, "TCP keep-alive period of Vault connections, the default transport's when 0")
+	vaultTLSHandshakeTimeout = flag.Duration("vault-tls-handshake-timeout", 0, "timeout of the TLS handshake with Vault, the default transport's when 0")
+)
+
+// vaultHTTPClient returns the HTTP client of the Vault client configured
+// from the flags, nil for the Vault client's default when none is set
+func vaultHTTPClient() (*http.Client, error) {
+	if *vaultProxy == "" && *vaultProxyUser == "" && *vaultTimeout == 0 && *vaultDialTimeout == 0 && *vaultKeepAlive == 0 && *vaultTLSHandshakeTimeout == 0 {
+		return nil, nil
+	}
+
+	// start from the default client, keeping the TLS settings of VAULT_CACERT
+	// and friends
+	defaults := api.DefaultConfig()
+	if defaults.Error != nil {
+		return nil, defaults.Error
+	}
+	client := defaults.HttpClient
+	if client == nil {
+		client = &http.Client{}
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("the Vault client's default transport cannot be configured")
+	}
+
+	if *vaultProxy != "" {
+		proxy, err := url.Parse(*vaultProxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid -vault-proxy %q", *vaultProxy)
+		}
+		if *vaultProxyUser != "" {
+			proxy.User = url.UserPassword(*vaultProxyUser, os.Getenv(vaultProxyPasswordEnv))
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	} else if *vaultProxyUser != "" {
+		return nil, errors.New("-vault-proxy-user needs -vault-proxy")
+	}
+
+	if *vaultDialTimeout > 0 || *vaultKeepAlive > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   durationOr(*vaultDialTimeout, 30*time.Second),
+			KeepAlive: durationOr(*vaultKeepAlive, 30*time.Second),
+		}).DialContext
+	}
+	if *vaultTLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = *vaultTLSHandshakeTimeout
+	}
+	if *vaultTimeout > 0 {
+		client.Timeout = *vaultTimeout
+	}
+
+	return client, nil
+}
+
+// durationOr returns value, fallback when it is not set
+func durationOr(value, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	vaultNamespace         = flag.String("vault-namespace", "", "Vault Enterprise namespace to work in (env VAULT_NAMESPACE)")
+	vaultNamespaceTemplate = flag.String("vault-namespace-template", "", "template of the Vault Enterprise namespace each service is written to, e.g. teams/{{.Namespace}}")
+)
+
+// vaultNamespace returns the Vault namespace the service is written to
+func (service *Service) vaultNamespace() (string, error) {
+	if *vaultNamespaceTemplate == "" {
+		return *vaultNamespace, nil
+	}
+
+	namespace := strings.Trim(service.parseTemplate(*vaultNamespaceTemplate), "/")
+	if namespace == "" {
+		return "", errors.New("something wrong with parsing vault namespace template")
+	}
+	if strings.Contains(namespace, "//") {
+		return "", fmt.Errorf("vault namespace %q has an empty segment", namespace)
+	}
+	return namespace, nil
+}
+
+// namespaceHeader header the Vault client sends the namespace in
+const namespaceHeader = "X-Vault-Namespace"
+
+// useNamespace switches the client to a Vault namespace, empty for the root
+func (vault *Vault) useNamespace(namespace string) {
+	if namespace == "" {
+		// this client version cannot clear the namespace, drop its header
+		headers := vault.client.Headers()
+		headers.Del(namespaceHeader)
+		vault.client.SetHeaders(headers)
+	} else {
+		vault.client.SetNamespace(namespace)
+	}
+	vault.namespace = namespace
+}
+
+// enterNamespace switches the client to the service's Vault namespace,
+// checking once per run that the namespace exists
+func (vault *Vault) enterNamespace(service Service) error {
+	namespace, err := service.vaultNamespace()
+	if err != nil {
+		return err
+	}
+
+	if namespace != "" && *vaultNamespaceTemplate != "" {
+		checked, ok := vault.namespaces[namespace]
+		if !ok {
+			checked = vault.checkNamespace(namespace)
+			vault.namespaces[namespace] = checked
+		}
+		if checked != nil {
+			return checked
+		}
+	}
+
+	vault.useNamespace(namespace)
+	return nil
+}
+
+// checkNamespace fails when the Vault namespace does not exist, looking it
+// up in its parent namespace
+func (vault *Vault) checkNamespace(namespace string) error {
+	parent, child := "", namespace
+	if i := strings.LastIndex(namespace, "/"); i >= 0 {
+		parent, child = namespace[:i], namespace[i+1:]
+	}
+
+	current := vault.namespace
+	defer vault.useNamespace(current)
+
+	vault.useNamespace(parent)
+	vault.use("sys/namespaces/"+child, "read")
+	secret, err := vault.client.Logical().Read("sys/namespaces/" + child)
+	if err != nil {
+		return fmt.Errorf("looking up Vault namespace %s: %v", namespace, err)
+	}
+	if secret == nil {
+		return fmt.Errorf("Vault namespace %s does not exist", namespace)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var verifyWrites = flag.Bool("verify-writes", false, "read every written policy and role back and fail when it differs from what was written")
+
+// normalizePolicy returns rule with insignificant whitespace removed
+func normalizePolicy(rule string) string {
+	return strings.Join(strings.Fields(rule), " ")
+}
+
+// normalizeRoleValue returns a role field in a comparable form: lists and
+// comma-separated strings sorted, durations in seconds
+func normalizeRoleValue(value interface{}) string {
+	var items []string
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		items = append(items, v...)
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+	case string:
+		if duration, err := time.ParseDuration(v); err == nil {
+			return strconv.Itoa(int(duration.Seconds()))
+		}
+		items = strings.Split(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// verifyPolicy reads policy name back and compares it with rule
+func (vault *Vault) verifyPolicy(name, rule string) error {
+	vault.use("sys/policy/"+name, "read")
+	stored, err := vault.client.Sys().GetPolicy(name)
+	if err != nil {
+		return fmt.Errorf("verifying policy %s: %v", name, err)
+	}
+
+	if normalizePolicy(stored) != normalizePolicy(rule) {
+		return fmt.Errorf("verifying policy %s: stored rule differs from the written one", name)
+	}
+
+	return nil
+}
+
+// verifyRole reads the role at path back and compares every written field
+func (vault *Vault) verifyRole(path string, data map[string]interface{}) error {
+	vault.use(path, "read")
+	secret, err := vault.client.Logical().Read(path)
+	if err != nil {
+		return fmt.Errorf("verifying role %s: %v", path, err)
+	}
+	if secret == nil {
+		return fmt.Errorf("verifying role %s: role not found", path)
+	}
+
+	if mismatches := roleMismatches(secret.Data, data); len(mismatches) > 0 {
+		return fmt.Errorf("verifying role %s: %s", path, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}